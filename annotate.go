@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Markers written by goblinLine around a buffer line number in the output of :run --annotate.
+const (
+	annotateMarkStart = "\x1e"
+	annotateMarkEnd   = "\x1f"
+)
+
+// annotateHarness is compiled along with a generated program instrumented by
+// instrumentLines. goblinLine writes a marker to stdout each time the executing buffer
+// line changes, so that the following output can be attributed to it.
+const annotateHarness = `package main
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+var (
+	goblinLineMu   sync.Mutex
+	goblinLastLine int
+)
+
+func goblinLine(line int) {
+	goblinLineMu.Lock()
+	defer goblinLineMu.Unlock()
+	if line == goblinLastLine {
+		return
+	}
+	goblinLastLine = line
+	os.Stdout.WriteString("\x1e" + strconv.Itoa(line) + "\x1f")
+}
+`
+
+// outputSegment is a piece of output attributed to a buffer line (0 if unknown).
+type outputSegment struct {
+	line int
+	text string
+}
+
+// instrumentLines adds a call to goblinLine before each statement of main, including
+// the statements of nested blocks and function literals. The calls are added on the
+// line of the statement, so the line numbers of the program are unchanged.
+func instrumentLines(program string, lineMap []int) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "repl_code.go", program, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil {
+		return "", fmt.Errorf("no main function found")
+	}
+
+	var insertions []insertion
+	instrumentList := func(list []ast.Stmt) {
+		for _, stmt := range list {
+			line := bufferLine(lineMap, fset.Position(stmt.Pos()).Line)
+			if line == 0 {
+				continue
+			}
+			insertions = append(insertions, insertion{fset.Position(stmt.Pos()).Offset, fmt.Sprintf("goblinLine(%d); ", line)})
+		}
+	}
+	ast.Inspect(mainFunc.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.BlockStmt:
+			instrumentList(node.List)
+		case *ast.CaseClause:
+			instrumentList(node.Body)
+		case *ast.CommClause:
+			instrumentList(node.Body)
+		}
+		return true
+	})
+	return applyInsertions(program, insertions), nil
+}
+
+// splitAnnotatedOutput separates the output of an instrumented program into segments
+// attributed to buffer lines, and returns the output without the markers.
+func splitAnnotatedOutput(raw string) (string, []outputSegment) {
+	var plain strings.Builder
+	var segments []outputSegment
+	line := 0
+	for {
+		start := strings.Index(raw, annotateMarkStart)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(raw[start:], annotateMarkEnd)
+		if end < 0 {
+			break
+		}
+		if start > 0 {
+			segments = append(segments, outputSegment{line: line, text: raw[:start]})
+			plain.WriteString(raw[:start])
+		}
+		line, _ = strconv.Atoi(raw[start+len(annotateMarkStart) : start+end])
+		raw = raw[start+end+len(annotateMarkEnd):]
+	}
+	if raw != "" {
+		segments = append(segments, outputSegment{line: line, text: raw})
+		plain.WriteString(raw)
+	}
+	return plain.String(), segments
+}
+
+// printAnnotatedOutput prints each line of output next to the buffer line that produced it.
+// The output is truncated to the max output setting, as by printOutput.
+func printAnnotatedOutput(output string, segments []outputSegment, codeLines []string) {
+	// 1. Cut the segments into output lines, each attributed to the line that started it
+	type outputLine struct {
+		line int
+		text string
+	}
+	var lines []outputLine
+	var current strings.Builder
+	currentLine, started := 0, false
+	for _, seg := range segments {
+		parts := strings.Split(seg.text, "\n")
+		for i, part := range parts {
+			if part != "" && !started {
+				currentLine, started = seg.line, true
+			}
+			current.WriteString(part)
+			if i < len(parts)-1 {
+				if !started {
+					currentLine = seg.line
+				}
+				lines = append(lines, outputLine{currentLine, current.String()})
+				current.Reset()
+				started = false
+			}
+		}
+	}
+	if current.Len() > 0 {
+		lines = append(lines, outputLine{currentLine, current.String()})
+	}
+
+	_, note := limitOutput(output)
+	if maxOutputLines > 0 && len(lines) > maxOutputLines {
+		lines = lines[:maxOutputLines]
+	}
+
+	// 2. Print them in a gutter showing the code of the line
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width = 80
+	}
+	codeWidth := width/2 - 8
+	if codeWidth < 10 {
+		codeWidth = 10
+	}
+	var rows []string
+	previous := -1
+	for _, l := range lines {
+		gutter := strings.Repeat(" ", 6+codeWidth)
+		if l.line != previous && l.line > 0 && l.line <= len(codeLines) {
+			code := []rune(strings.TrimSpace(codeLines[l.line-1]))
+			if len(code) > codeWidth {
+				code = append(code[:codeWidth-1], '…')
+			}
+			gutter = fmt.Sprintf("%4d: %s%s", l.line, string(code), strings.Repeat(" ", codeWidth-len(code)))
+		}
+		previous = l.line
+		rows = append(rows, snippetColor(gutter)+" | "+outputColor(l.text))
+	}
+	printBoxed("Annotated Output", rows)
+	if note != "" {
+		fmt.Println(infoColor("%s", note))
+	}
+}
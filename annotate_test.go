@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstrumentLines(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string // Instrumented lines of main
+	}{
+		{
+			"statements",
+			"x := 1\nprintln(x)",
+			[]string{"goblinLine(1); x := 1", "goblinLine(2); println(x)"},
+		},
+		{
+			"nested blocks",
+			"for i := 0; i < 2; i++ {\n\tprintln(i)\n}",
+			[]string{"goblinLine(1); for i := 0; i < 2; i++ {", "\tgoblinLine(2); println(i)"},
+		},
+		{
+			"switch cases",
+			"switch x := 1; x {\ncase 1:\n\tprintln(x)\n}",
+			[]string{"goblinLine(1); switch x := 1; x {", "\tgoblinLine(3); println(x)"},
+		},
+		{
+			"function literal",
+			"f := func() {\n\tprintln(1)\n}\nf()",
+			[]string{"goblinLine(1); f := func() {", "\tgoblinLine(2); println(1)", "goblinLine(4); f()"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, lineMap := generateProgramMap(tt.code)
+			got, err := instrumentLines(program, lineMap)
+			if err != nil {
+				t.Fatalf("instrumentLines() error = %v", err)
+			}
+			if strings.Count(got, "\n") != strings.Count(program, "\n") {
+				t.Errorf("instrumentLines() changed the number of lines:\n%s", got)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(got, "\n"+line+"\n") {
+					t.Errorf("instrumentLines() has no line %q:\n%s", line, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitAnnotatedOutput(t *testing.T) {
+	mark := func(line string) string { return annotateMarkStart + line + annotateMarkEnd }
+	tests := []struct {
+		name     string
+		raw      string
+		plain    string
+		segments []outputSegment
+	}{
+		{"no markers", "a\n", "a\n", []outputSegment{{0, "a\n"}}},
+		{"lines", mark("1") + "a\n" + mark("3") + "b\nc\n", "a\nb\nc\n", []outputSegment{{1, "a\n"}, {3, "b\nc\n"}}},
+		{"line without output", mark("1") + mark("2") + "b", "b", []outputSegment{{2, "b"}}},
+		{"output before the first marker", "a" + mark("2") + "b", "ab", []outputSegment{{0, "a"}, {2, "b"}}},
+		{"empty", "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, segments := splitAnnotatedOutput(tt.raw)
+			if plain != tt.plain {
+				t.Errorf("splitAnnotatedOutput() output = %q, want %q", plain, tt.plain)
+			}
+			if len(segments) != len(tt.segments) {
+				t.Fatalf("splitAnnotatedOutput() segments = %+v, want %+v", segments, tt.segments)
+			}
+			for i := range segments {
+				if segments[i] != tt.segments[i] {
+					t.Errorf("segment %d = %+v, want %+v", i, segments[i], tt.segments[i])
+				}
+			}
+		})
+	}
+}
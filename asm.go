@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SSA_DIR is the directory where the GOSSAFUNC HTML dumps are written.
+var SSA_DIR = filepath.Join(os.Getenv("HOME"), ".goblin", "ssa")
+
+var (
+	// asmFuncRegex matches the header of a function in the output of -gcflags=-S.
+	asmFuncRegex = regexp.MustCompile(`^(\S+) STEXT`)
+	// asmInstrRegex matches an instruction: offset, position, (file:line) and the instruction itself.
+	asmInstrRegex = regexp.MustCompile(`^\t(0x[0-9a-f]+) \d+ \((.+):(\d+)\)\t(.*)$`)
+)
+
+// asmSymbolMatches reports whether the assembly symbol sym belongs to the function name
+// given by the user ("f", "T.M" or "(*T).M"), including the closures declared inside it.
+func asmSymbolMatches(sym, name string) bool {
+	candidates := []string{"main." + name}
+	if typ, method, ok := strings.Cut(name, "."); ok && !strings.HasPrefix(name, "(") {
+		candidates = append(candidates, "main.(*"+typ+")."+method)
+	}
+	for _, c := range candidates {
+		if sym == c || strings.HasPrefix(sym, c+".func") {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAsm compiles the buffer with -gcflags=-S and prints the assembly of a function,
+// interleaved with the buffer lines it was generated from.
+func handleAsm(codeLines []string, args []string) {
+	if len(args) != 1 {
+		fmt.Println(infoColor("Usage: :asm <function_name>"))
+		return
+	}
+	name := args[0]
+
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	tmpDir, _, output, err := buildProgram(program, []string{"-gcflags=-S"})
+	if err != nil {
+		fmt.Print(outputColor(output))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var lines []string
+	var available []string
+	inFunc := false
+	lastFile, lastLine := "", -1
+	for _, line := range strings.Split(output, "\n") {
+		if matches := asmFuncRegex.FindStringSubmatch(line); matches != nil {
+			sym := matches[1]
+			if strings.HasPrefix(sym, "main.") {
+				available = append(available, strings.TrimPrefix(sym, "main."))
+			}
+			inFunc = asmSymbolMatches(sym, name)
+			if inFunc {
+				if len(lines) > 0 {
+					lines = append(lines, "")
+				}
+				lines = append(lines, infoColor("%s", line))
+				lastFile, lastLine = "", -1
+			}
+			continue
+		}
+		if !inFunc {
+			continue
+		}
+		if !strings.HasPrefix(line, "\t") {
+			inFunc = false
+			continue
+		}
+		matches := asmInstrRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue // Raw machine code and relocations
+		}
+		offset, file, instr := matches[1], matches[2], matches[4]
+		if strings.HasPrefix(instr, "FUNCDATA") || strings.HasPrefix(instr, "PCDATA") {
+			continue
+		}
+		lineNum, _ := strconv.Atoi(matches[3])
+
+		// Print the source line each time the position changes
+		if file != lastFile || lineNum != lastLine {
+			lastFile, lastLine = file, lineNum
+			if strings.HasSuffix(file, "repl_code.go") {
+				if n := bufferLine(lineMap, lineNum); n > 0 {
+					lines = append(lines, snippetColor(fmt.Sprintf("%4d: %s", n, codeLines[n-1])))
+				}
+			} else {
+				lines = append(lines, snippetColor(fmt.Sprintf("      (inlined from %s:%d)", filepath.Base(file), lineNum)))
+			}
+		}
+		lines = append(lines, fmt.Sprintf("        %s  %s", offset, strings.ReplaceAll(instr, "\t", " ")))
+	}
+
+	if len(lines) == 0 {
+		fmt.Fprintln(os.Stderr, errorColor("No function named '%s' found in the buffer.", name))
+		if len(available) > 0 {
+			sort.Strings(available)
+			fmt.Println(infoColor("Available functions: %s", strings.Join(available, ", ")))
+		}
+		return
+	}
+	printBoxed("Assembly of "+name, lines)
+}
+
+// handleSsa compiles the buffer with GOSSAFUNC set and copies the resulting HTML
+// dump of the SSA passes to SSA_DIR.
+func handleSsa(code string, args []string) {
+	if len(args) != 1 {
+		fmt.Println(infoColor("Usage: :ssa <function_name>"))
+		return
+	}
+	name := args[0]
+
+	tmpDir, _, output, err := buildProgramFiles(generateProgram(code), nil, nil, []string{"GOSSAFUNC=" + name})
+	if err != nil {
+		fmt.Print(outputColor(output))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	data, err := ioutil.ReadFile(filepath.Join(tmpDir, "ssa.html"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("No SSA dump was produced for '%s'. Check the function name, e.g. f, T.M or (*T).M.", name))
+		return
+	}
+
+	if err := os.MkdirAll(SSA_DIR, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error creating SSA directory: %v", err))
+		return
+	}
+	fileName := regexp.MustCompile(`[^\w.-]+`).ReplaceAllString(name, "_") + ".html"
+	outputPath := filepath.Join(SSA_DIR, fileName)
+	if err := ioutil.WriteFile(outputPath, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error writing SSA dump to '%s': %v", outputPath, err))
+		return
+	}
+	fmt.Println(successColor("SSA dump of '%s' written to '%s'.", name, outputPath))
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestAsmSymbolMatches(t *testing.T) {
+	tests := []struct {
+		sym, name string
+		want      bool
+	}{
+		{"main.f", "f", true},
+		{"main.f.func1", "f", true},
+		{"main.f.func1.1", "f", true},
+		{"main.fg", "f", false},
+		{"main.g", "f", false},
+		{"main.T.M", "T.M", true},
+		{"main.(*T).M", "T.M", true},
+		{"main.(*T).M.func2", "T.M", true},
+		{"main.(*T).M", "(*T).M", true},
+		{"main.T.M", "(*T).M", false},
+		{"main.T.MM", "T.M", false},
+		{"fmt.f", "f", false},
+	}
+	for _, tt := range tests {
+		if got := asmSymbolMatches(tt.sym, tt.name); got != tt.want {
+			t.Errorf("asmSymbolMatches(%q, %q) = %v, want %v", tt.sym, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes of the check of the lines entered, set with :check.
+const (
+	checkOff    = "off"
+	checkOn     = "on"     // Report the errors of the new lines
+	checkStrict = "strict" // Also reject the lines that do not parse
+)
+
+// liveCheckMode is how the lines entered are checked.
+var liveCheckMode = checkOn
+
+// liveCheckWait is how long a type check is waited for before letting it finish in the
+// background, which happens when the imported packages are checked for the first time.
+const liveCheckWait = 200 * time.Millisecond
+
+// liveCheck tracks the checks of the buffer.
+var liveCheck struct {
+	sync.Mutex
+	generation int // Incremented by each check, so that the result of an outdated one is dropped
+}
+
+// bufferError is an error found by a check, located on a buffer line.
+type bufferError struct {
+	line int
+	msg  string
+}
+
+// syntaxErrors returns the syntax errors of buffer lines, starting at the line first.
+// The lines are parsed on their own, so that the errors of the lines before them do not
+// hide theirs, which requires them to start outside of any declaration or block.
+func syntaxErrors(lines []string, first int) ([]bufferError, bool) {
+	program, lineMap := generateProgramMap(strings.Join(lines, "\n"))
+	_, err := parser.ParseFile(token.NewFileSet(), "repl_code.go", program, parser.AllErrors)
+	if err == nil {
+		return nil, true
+	}
+	var errs []bufferError
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, e := range list {
+			if line := bufferLine(lineMap, e.Pos.Line); line > 0 {
+				errs = append(errs, bufferError{line + first - 1, e.Msg})
+			}
+		}
+	}
+	return errs, false
+}
+
+// typeErrors returns the type errors of the buffer lines from the line from. Errors such
+// as unused variables and imports are left out, as they are expected while typing.
+func typeErrors(program string, lineMap []int, from int) []bufferError {
+	_, _, _, typeErrs, err := typeCheckProgram(program)
+	if err != nil {
+		return nil
+	}
+	var errs []bufferError
+	for _, e := range typeErrs {
+		if e.Soft {
+			continue
+		}
+		if line := bufferLine(lineMap, e.Fset.Position(e.Pos).Line); line >= from {
+			errs = append(errs, bufferError{line, e.Msg})
+		}
+	}
+	return errs
+}
+
+// formatBufferErrors writes the errors of a check, one per line.
+func formatBufferErrors(errs []bufferError) string {
+	var b strings.Builder
+	for _, e := range errs {
+		b.WriteString(infoColor("Warning line %d: %s", e.line, e.msg) + "\n")
+	}
+	return b.String()
+}
+
+// checkEntry checks an entry once it is appended to the buffer, its lines starting at the
+// line first, and reports its errors. Syntax is checked at once; types are checked in the
+// background when it takes long, the errors being written to stdout when they are known.
+// It returns how many lines of the buffer are kept: in strict mode, the lines of an entry
+// that does not parse are rejected, and only them.
+func checkEntry(stdout io.Writer, codeLines []string, first int) int {
+	n := len(codeLines)
+	if liveCheckMode == checkOff || first < 1 || first > n || !startsTopLevel(codeLines[:first-1]) || !startsTopLevel(codeLines) {
+		return n
+	}
+	liveCheck.Lock()
+	liveCheck.generation++
+	generation := liveCheck.generation
+	liveCheck.Unlock()
+
+	// 1. Syntax of the entry
+	errs, parsed := syntaxErrors(codeLines[first-1:], first)
+	if !parsed {
+		fmt.Print(formatBufferErrors(errs))
+		if liveCheckMode == checkStrict {
+			if first == n {
+				fmt.Println(errorColor("Line rejected as it does not parse. Fix it and enter it again, or use ':check on' to accept it."))
+			} else {
+				fmt.Println(errorColor("Lines %d-%d rejected as they do not parse. Fix them and enter them again, or use ':check on' to accept them:", first, n))
+				for i := first; i <= n; i++ {
+					fmt.Println(codeLines[i-1])
+				}
+			}
+			return first - 1
+		}
+		return n
+	}
+
+	// 2. Types, which are only checked when the whole buffer parses
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	done := make(chan []bufferError, 1)
+	go func() {
+		done <- typeErrors(program, lineMap, first)
+	}()
+	report := func(errs []bufferError, w io.Writer) {
+		liveCheck.Lock()
+		defer liveCheck.Unlock()
+		if generation != liveCheck.generation {
+			// The buffer changed since, :check reports the errors still there
+			return
+		}
+		fmt.Fprint(w, formatBufferErrors(errs))
+	}
+	select {
+	case errs := <-done:
+		report(errs, os.Stdout)
+	case <-time.After(liveCheckWait):
+		go func() {
+			report(<-done, stdout)
+		}()
+	}
+	return n
+}
+
+// resetLiveCheck drops the result of the check still running, once the buffer is changed
+// by something else than an entry.
+func resetLiveCheck() {
+	liveCheck.Lock()
+	liveCheck.generation++
+	liveCheck.Unlock()
+}
+
+// handleCheck sets the mode of the check of the lines entered, or checks the whole buffer.
+func handleCheck(codeLines []string, args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case checkOff, checkOn, checkStrict:
+			liveCheckMode = args[0]
+			fmt.Println(successColor("Live check: %s.", liveCheckMode))
+		default:
+			fmt.Println(infoColor("Usage: :check [on|off|strict]"))
+		}
+		return
+	}
+
+	if len(codeLines) == 0 {
+		fmt.Println(infoColor("No code in buffer to check. Live check: %s.", liveCheckMode))
+		return
+	}
+	errs, parsed := syntaxErrors(codeLines, 1)
+	if parsed {
+		program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+		errs = typeErrors(program, lineMap, 1)
+	}
+	if len(errs) == 0 {
+		fmt.Println(successColor("No errors found. Live check: %s.", liveCheckMode))
+		return
+	}
+	fmt.Print(formatBufferErrors(errs))
+	if len(errs) == 1 {
+		fmt.Fprintln(os.Stderr, errorColor("1 error found. Live check: %s.", liveCheckMode))
+	} else {
+		fmt.Fprintln(os.Stderr, errorColor("%d errors found. Live check: %s.", len(errs), liveCheckMode))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestCheckEntry(t *testing.T) {
+	loaded := []string{
+		"type point struct {",
+		"	x, y int",
+		"}",
+		"",
+		"func (p point) sum() int {",
+		"	return p.x + p.y",
+		"}",
+		"p := point{1, 2}",
+	}
+	tests := []struct {
+		name   string
+		mode   string
+		buffer []string
+		entry  []string
+		want   int
+	}{
+		{"valid entry", checkStrict, loaded, []string{"fmt.Println(p.sum())"}, 9},
+		{"invalid entry kept", checkOn, loaded, []string{"x := )"}, 9},
+		{"invalid entry rejected", checkStrict, loaded, []string{"x := )"}, 8},
+		{"invalid block rejected", checkStrict, loaded, []string{"if p.x > 0 {", "	x := )", "}"}, 8},
+		{"invalid buffer before", checkStrict, []string{"x := )", "y := 1"}, []string{"z := 2"}, 3},
+		{"empty buffer", checkStrict, nil, []string{"x := )"}, 0},
+		{"check off", checkOff, loaded, []string{"x := )"}, 9},
+	}
+	defer func(mode string) { liveCheckMode = mode }(liveCheckMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			liveCheckMode = tt.mode
+			codeLines := append(append([]string(nil), tt.buffer...), tt.entry...)
+			if got := checkEntry(io.Discard, codeLines, len(tt.buffer)+1); got != tt.want {
+				t.Errorf("checkEntry() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCheckEntrySequence checks that a rejected entry has no effect on the next checks,
+// even when the buffer is replaced in between, as by :load.
+func TestCheckEntrySequence(t *testing.T) {
+	defer func(mode string) { liveCheckMode = mode }(liveCheckMode)
+	liveCheckMode = checkStrict
+
+	codeLines := []string{"x := 1", "y := )"}
+	if got := checkEntry(io.Discard, codeLines, 2); got != 1 {
+		t.Fatalf("checkEntry() = %d, want 1", got)
+	}
+	codeLines = []string{"a := 1", "b := 2", "c := 3", "d := 4", "e := 5", "f := 6", "g := 7", "h := 8"}
+	codeLines = append(codeLines, "i := )")
+	if got := checkEntry(io.Discard, codeLines, 9); got != 8 {
+		t.Errorf("checkEntry() after a load = %d, want 8", got)
+	}
+}
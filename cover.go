@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// coverBlockRegex matches a block of the text coverage format:
+// file:startLine.startCol,endLine.endCol numStatements count
+var coverBlockRegex = regexp.MustCompile(`^(.+):(\d+)\.\d+,(\d+)\.\d+ (\d+) (\d+)$`)
+
+// parseCoverProfile reads a text coverage profile and returns the execution count
+// of each line of the generated program that holds statements.
+func parseCoverProfile(path string) (map[int]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counts := make(map[int]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		matches := coverBlockRegex.FindStringSubmatch(scanner.Text())
+		if matches == nil || !strings.HasSuffix(matches[1], "repl_code.go") {
+			continue
+		}
+		startLine, _ := strconv.Atoi(matches[2])
+		endLine, _ := strconv.Atoi(matches[3])
+		count, _ := strconv.Atoi(matches[5])
+		for line := startLine; line <= endLine; line++ {
+			if c, ok := counts[line]; !ok || count > c {
+				counts[line] = count
+			}
+		}
+	}
+	return counts, scanner.Err()
+}
+
+// handleCover runs the buffer with coverage instrumentation and displays each line
+// of the buffer with the number of times it was executed.
+func handleCover(codeLines []string, args []string) {
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+
+	tmpDir, binPath, buildOutput, err := buildProgram(program, []string{"-cover", "-covermode=count"})
+	if err != nil {
+		fmt.Print(outputColor(buildOutput))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// 1. Run the instrumented binary, collecting the counters in GOCOVERDIR
+	coverDir := filepath.Join(tmpDir, "cover")
+	if err := os.Mkdir(coverDir, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error creating coverage directory: %v", err))
+		return
+	}
+	cmd := exec.Command(binPath, args...)
+	cmd.Env = append(os.Environ(), "GOCOVERDIR="+coverDir)
+	output, execErr := cmd.CombinedOutput()
+
+	printOutput(string(output))
+	if execErr != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Code Execution Finished with Error Status."))
+	}
+
+	// 2. Convert the counters to the text format
+	profilePath := filepath.Join(tmpDir, "cover.txt")
+	covCmd := exec.Command("go", "tool", "covdata", "textfmt", "-i="+coverDir, "-o="+profilePath)
+	if out, err := covCmd.CombinedOutput(); err != nil {
+		fmt.Print(outputColor(string(out)))
+		fmt.Fprintln(os.Stderr, errorColor("Error reading coverage data: %v", err))
+		return
+	}
+	counts, err := parseCoverProfile(profilePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error reading coverage data: %v", err))
+		return
+	}
+
+	// 3. Map the counts back to the buffer lines
+	lineCounts := make(map[int]int)
+	for generatedLine, count := range counts {
+		n := bufferLine(lineMap, generatedLine)
+		// Blocks extend to their closing brace, which is not worth marking
+		if n == 0 || strings.TrimSpace(codeLines[n-1]) == "}" {
+			continue
+		}
+		if c, ok := lineCounts[n]; !ok || count > c {
+			lineCounts[n] = count
+		}
+	}
+
+	hit := 0
+	var lines []string
+	for i, line := range codeLines {
+		marker := strings.Repeat(" ", 8)
+		if count, ok := lineCounts[i+1]; ok {
+			if count > 0 {
+				hit++
+				marker = successColor("%7dx", count)
+			} else {
+				marker = errorColor("%8s", "miss")
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%4d: %s | %s", i+1, marker, line))
+	}
+	printBoxed("Coverage", lines)
+
+	if len(lineCounts) > 0 {
+		fmt.Println(infoColor("%d of %d executable lines hit (%.1f%%).", hit, len(lineCounts), 100*float64(hit)/float64(len(lineCounts))))
+	} else {
+		fmt.Println(infoColor("No executable lines found in the buffer."))
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCoverProfile(t *testing.T) {
+	profile := "mode: count\n" +
+		"command-line-arguments/repl_code.go:10.13,12.2 2 1\n" +
+		"command-line-arguments/repl_code.go:12.2,12.20 1 5\n" +
+		"command-line-arguments/repl_code.go:15.2,15.9 1 0\n" +
+		"command-line-arguments/other.go:10.1,10.5 1 9\n" +
+		"not a block\n"
+	path := filepath.Join(t.TempDir(), "cover.out")
+	if err := os.WriteFile(path, []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseCoverProfile(path)
+	if err != nil {
+		t.Fatalf("parseCoverProfile() error = %v", err)
+	}
+	// A line shared by blocks takes the highest count
+	want := map[int]int{10: 1, 11: 1, 12: 5, 15: 0}
+	if !maps.Equal(got, want) {
+		t.Errorf("parseCoverProfile() = %v, want %v", got, want)
+	}
+
+	if _, err := parseCoverProfile(filepath.Join(t.TempDir(), "missing.out")); err == nil {
+		t.Errorf("parseCoverProfile() of a missing file succeeded")
+	}
+}
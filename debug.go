@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types below mirror the parts of the JSON-RPC API (version 2) of Delve used by
+// :debug, so that goblin drives a locally installed dlv without depending on its packages.
+
+type dlvBreakpoint struct {
+	ID           int    `json:"id"`
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	FunctionName string `json:"functionName,omitempty"`
+}
+
+type dlvFunction struct {
+	Name string `json:"name"`
+}
+
+type dlvThread struct {
+	File       string         `json:"file"`
+	Line       int            `json:"line"`
+	Function   *dlvFunction   `json:"function,omitempty"`
+	Breakpoint *dlvBreakpoint `json:"breakPoint,omitempty"`
+}
+
+type dlvState struct {
+	Running       bool       `json:"Running"`
+	CurrentThread *dlvThread `json:"currentThread,omitempty"`
+	Exited        bool       `json:"exited"`
+	ExitStatus    int        `json:"exitStatus"`
+}
+
+type dlvVariable struct {
+	Name       string        `json:"name"`
+	Addr       uint64        `json:"addr"`
+	Type       string        `json:"type"`
+	Kind       reflect.Kind  `json:"kind"`
+	Value      string        `json:"value"`
+	Len        int64         `json:"len"`
+	Children   []dlvVariable `json:"children"`
+	Unreadable string        `json:"unreadable"`
+}
+
+type dlvEvalScope struct {
+	GoroutineID  int64
+	Frame        int
+	DeferredCall int
+}
+
+type dlvLoadConfig struct {
+	FollowPointers     bool
+	MaxVariableRecurse int
+	MaxStringLen       int
+	MaxArrayValues     int
+	MaxStructFields    int
+}
+
+// debugLoadConfig is how much of a variable is loaded by :locals and :print.
+var debugLoadConfig = dlvLoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+
+// debugCurrentScope is the current frame of the selected goroutine.
+var debugCurrentScope = dlvEvalScope{GoroutineID: -1}
+
+// debugSession is a headless dlv debugging the program generated from the buffer.
+type debugSession struct {
+	cmd         *exec.Cmd
+	client      *rpc.Client
+	tmpDir      string
+	programPath string   // Path of repl_code.go, as known by the debugger
+	lineMap     []int    // Buffer line of each line of the program
+	codeLines   []string // Buffer when the session was started
+	breakpoints map[int]int
+}
+
+var (
+	// debugger is the running debugging session, nil if none.
+	debugger *debugSession
+	// debugBreakpoints are the buffer lines set with :break, in order. They are kept from a
+	// session to the next.
+	debugBreakpoints []debugBreakpoint
+)
+
+// debugBreakpoint is a breakpoint on a buffer line, with the text of the line when it was
+// set, to follow the line when the buffer changes.
+type debugBreakpoint struct {
+	line int
+	text string
+}
+
+// relocateBreakpoints follows the lines of the breakpoints in the buffer after it changed.
+// A breakpoint whose line has moved goes to the nearest line with the same text, and a
+// breakpoint whose line is gone is removed. It returns the breakpoints and what was done.
+func relocateBreakpoints(breakpoints []debugBreakpoint, codeLines []string) ([]debugBreakpoint, []string) {
+	var kept []debugBreakpoint
+	var notes []string
+	for _, bp := range breakpoints {
+		if bp.line <= len(codeLines) && codeLines[bp.line-1] == bp.text {
+			kept = append(kept, bp)
+			continue
+		}
+		moved := 0
+		for i, line := range codeLines {
+			if line == bp.text && (moved == 0 || abs(i+1-bp.line) < abs(moved-bp.line)) {
+				moved = i + 1
+			}
+		}
+		if moved == 0 {
+			notes = append(notes, fmt.Sprintf("Breakpoint at line %d removed: the line is not in the buffer anymore.", bp.line))
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("Breakpoint at line %d moved to line %d, where its line is now.", bp.line, moved))
+		kept = append(kept, debugBreakpoint{moved, bp.text})
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].line < kept[j].line })
+	return slices.CompactFunc(kept, func(a, b debugBreakpoint) bool { return a.line == b.line }), notes
+}
+
+// followBreakpoints relocates the breakpoints of the session in the buffer and prints what
+// was done.
+func followBreakpoints(codeLines []string) {
+	var notes []string
+	debugBreakpoints, notes = relocateBreakpoints(debugBreakpoints, codeLines)
+	for _, note := range notes {
+		fmt.Println(infoColor("%s", note))
+	}
+}
+
+// abs returns the absolute value of n.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// dlvListenRegex matches the line printed by a headless dlv once it accepts connections.
+var dlvListenRegex = regexp.MustCompile(`API server listening at: (\S+)`)
+
+// findDlv returns the path of dlv, looking in the PATH then in the bin directory of GOPATH,
+// where 'go install' puts it.
+func findDlv() (string, error) {
+	if path, err := exec.LookPath("dlv"); err == nil {
+		return path, nil
+	}
+	if out, err := exec.Command("go", "env", "GOPATH").Output(); err == nil {
+		for _, dir := range filepath.SplitList(strings.TrimSpace(string(out))) {
+			path := filepath.Join(dir, "bin", "dlv")
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("dlv was not found")
+}
+
+// generatedLine returns the line of the program holding a buffer line, 0 if none.
+func generatedLine(lineMap []int, line int) int {
+	for i, l := range lineMap {
+		if l == line {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// handleDebug starts a debugging session on the buffer, or stops it with 'stop'.
+func handleDebug(codeLines []string, args []string) {
+	if len(args) == 1 && args[0] == "stop" {
+		if debugger == nil {
+			fmt.Println(infoColor("No debugging session is running."))
+			return
+		}
+		stopDebugSession()
+		fmt.Println(successColor("Debugging session stopped."))
+		return
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	dlvPath, err := findDlv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Delve is not installed: the 'dlv' command was not found in the PATH or in $GOPATH/bin."))
+		fmt.Println(infoColor("Install it with: go install github.com/go-delve/delve/cmd/dlv@latest"))
+		return
+	}
+	if len(codeLines) == 0 {
+		fmt.Println("No code to debug. Add statements first.")
+		return
+	}
+	if debugger != nil {
+		stopDebugSession()
+		fmt.Println(infoColor("The previous debugging session was stopped."))
+	}
+
+	// 1. Build the program without optimizations nor inlining
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	tmpDir, binPath, buildOutput, err := buildProgram(program, []string{"-gcflags=all=-N -l"})
+	if err != nil {
+		fmt.Print(outputColor(buildOutput))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	programPath := filepath.Join(tmpDir, "repl_code.go")
+	if resolved, err := filepath.EvalSymlinks(programPath); err == nil {
+		programPath = resolved
+	}
+
+	// 2. Start dlv in headless mode and connect to it
+	session := &debugSession{
+		tmpDir:      tmpDir,
+		programPath: programPath,
+		lineMap:     lineMap,
+		codeLines:   append([]string(nil), codeLines...),
+		breakpoints: make(map[int]int),
+	}
+	dlvArgs := append([]string{"exec", "--headless", "--api-version=2", "--listen=127.0.0.1:0", binPath, "--"}, args...)
+	session.cmd = exec.Command(dlvPath, dlvArgs...)
+	session.cmd.Dir = tmpDir
+	session.cmd.Stderr = os.Stderr
+	stdout, err := session.cmd.StdoutPipe()
+	if err == nil {
+		err = session.cmd.Start()
+	}
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		fmt.Fprintln(os.Stderr, errorColor("Failed to start dlv: %v", err))
+		return
+	}
+
+	address := make(chan string, 1)
+	go func() {
+		// The output of the debugged program goes through dlv, once it is listening
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if matches := dlvListenRegex.FindStringSubmatch(scanner.Text()); matches != nil {
+				address <- matches[1]
+				break
+			}
+		}
+		close(address)
+		io.Copy(os.Stdout, stdout)
+	}()
+
+	var addr string
+	select {
+	case addr = <-address:
+	case <-time.After(10 * time.Second):
+	}
+	if addr == "" {
+		session.kill()
+		fmt.Fprintln(os.Stderr, errorColor("dlv did not start its API server."))
+		return
+	}
+	session.client, err = jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		session.kill()
+		fmt.Fprintln(os.Stderr, errorColor("Failed to connect to dlv: %v", err))
+		return
+	}
+	var versionOut struct{}
+	session.client.Call("RPCServer.SetApiVersion", struct{ APIVersion int }{2}, &versionOut)
+	debugger = session
+
+	// 3. Set the breakpoints and run to the start of main
+	followBreakpoints(codeLines)
+	for _, bp := range debugBreakpoints {
+		if err := session.createBreakpoint(bp.line); err != nil {
+			fmt.Fprintln(os.Stderr, errorColor("Breakpoint at line %d: %v", bp.line, err))
+		}
+	}
+	var entry struct{ Breakpoint dlvBreakpoint }
+	if err := session.client.Call("RPCServer.CreateBreakpoint", struct{ Breakpoint dlvBreakpoint }{dlvBreakpoint{FunctionName: "main.main"}}, &entry); err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Failed to stop at the start of main: %v", err))
+		stopDebugSession()
+		return
+	}
+	fmt.Println(infoColor("Debugging the buffer with %s. Use :break N, :next, :step, :continue, :locals, :print <expr> and :debug stop.", dlvPath))
+	debugCommand("continue")
+	if debugger != nil {
+		var cleared struct{}
+		debugger.client.Call("RPCServer.ClearBreakpoint", struct{ Id int }{entry.Breakpoint.ID}, &cleared)
+	}
+}
+
+// createBreakpoint sets a breakpoint on a buffer line.
+func (s *debugSession) createBreakpoint(line int) error {
+	if _, ok := s.breakpoints[line]; ok {
+		return nil
+	}
+	genLine := generatedLine(s.lineMap, line)
+	if genLine == 0 {
+		return fmt.Errorf("the line is not part of the program")
+	}
+	var out struct{ Breakpoint dlvBreakpoint }
+	err := s.client.Call("RPCServer.CreateBreakpoint", struct{ Breakpoint dlvBreakpoint }{dlvBreakpoint{File: s.programPath, Line: genLine}}, &out)
+	if err != nil {
+		return err
+	}
+	s.breakpoints[line] = out.Breakpoint.ID
+	return nil
+}
+
+// kill ends dlv and the debugged program, and removes the build directory.
+func (s *debugSession) kill() {
+	if s.client != nil {
+		var out struct{}
+		s.client.Call("RPCServer.Detach", struct{ Kill bool }{true}, &out)
+		s.client.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		s.cmd.Process.Kill()
+		<-done
+	}
+	os.RemoveAll(s.tmpDir)
+}
+
+// stopDebugSession ends the running debugging session, if any.
+func stopDebugSession() {
+	if debugger != nil {
+		debugger.kill()
+		debugger = nil
+	}
+}
+
+// handleBreak sets breakpoints on buffer lines, or lists them. Breakpoints set without
+// a running session are applied by the next :debug. The breakpoints follow their lines when
+// the buffer changes.
+func handleBreak(args []string, codeLines []string) {
+	followBreakpoints(codeLines)
+	if len(args) == 0 {
+		if len(debugBreakpoints) == 0 {
+			fmt.Println(infoColor("No breakpoints. Usage: :break <line> [<line>...]"))
+		} else {
+			lines := make([]string, len(debugBreakpoints))
+			for i, bp := range debugBreakpoints {
+				lines[i] = strconv.Itoa(bp.line)
+			}
+			fmt.Println(infoColor("Breakpoints on lines %s.", strings.Join(lines, ", ")))
+		}
+		return
+	}
+	for _, arg := range args {
+		line, err := strconv.Atoi(arg)
+		if err != nil || line < 1 || line > len(codeLines) {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid line number: %s. Must be between 1 and %d.", arg, len(codeLines)))
+			continue
+		}
+		if debugger != nil {
+			if !slices.Equal(debugger.codeLines, codeLines) {
+				fmt.Println(infoColor("The buffer changed since :debug started: the breakpoint at line %d is set from the next :debug.", line))
+			} else if err := debugger.createBreakpoint(line); err != nil {
+				fmt.Fprintln(os.Stderr, errorColor("Cannot set a breakpoint at line %d: %v", line, err))
+				continue
+			}
+		}
+		if !slices.ContainsFunc(debugBreakpoints, func(bp debugBreakpoint) bool { return bp.line == line }) {
+			debugBreakpoints = append(debugBreakpoints, debugBreakpoint{line, codeLines[line-1]})
+			sort.Slice(debugBreakpoints, func(i, j int) bool { return debugBreakpoints[i].line < debugBreakpoints[j].line })
+		}
+		fmt.Println(successColor("Breakpoint set at line %d.", line))
+	}
+}
+
+// debugCommand runs next, step or continue in the debugging session and shows where
+// the program stopped.
+func debugCommand(name string) {
+	if debugger == nil {
+		fmt.Println(infoColor("No debugging session is running. Start one with :debug."))
+		return
+	}
+	var out struct{ State dlvState }
+	err := debugger.client.Call("RPCServer.Command", struct {
+		Name string `json:"name"`
+	}{name}, &out)
+	if err != nil {
+		if strings.Contains(err.Error(), "has exited with status") {
+			fmt.Println(infoColor("%s", err.Error()))
+			stopDebugSession()
+			return
+		}
+		fmt.Fprintln(os.Stderr, errorColor("%s: %v", name, err))
+		if err == rpc.ErrShutdown {
+			stopDebugSession()
+		}
+		return
+	}
+	if out.State.Exited {
+		fmt.Println(infoColor("The program exited with status %d. Debugging session stopped.", out.State.ExitStatus))
+		stopDebugSession()
+		return
+	}
+	debugger.printLocation(out.State.CurrentThread)
+}
+
+// printLocation shows the buffer lines around the line where the program stopped.
+func (s *debugSession) printLocation(thread *dlvThread) {
+	if thread == nil {
+		return
+	}
+	inProgram := thread.File == s.programPath || filepath.Base(thread.File) == "repl_code.go"
+	line := 0
+	if inProgram {
+		line = bufferLine(s.lineMap, thread.Line)
+	}
+	if inProgram && line == 0 {
+		fmt.Println(infoColor("Stopped at line %d of the generated program, outside of the buffer lines. Use :next to reach them.", thread.Line))
+		return
+	}
+	if line == 0 {
+		function := "?"
+		if thread.Function != nil {
+			function = thread.Function.Name
+		}
+		fmt.Println(infoColor("Stopped in %s (%s:%d), outside of the buffer lines.", function, filepath.Base(thread.File), thread.Line))
+		return
+	}
+
+	if thread.Breakpoint != nil && thread.Breakpoint.FunctionName == "" {
+		fmt.Println(infoColor("Breakpoint hit at line %d.", line))
+	}
+	for n := line - 2; n <= line+2; n++ {
+		if n < 1 || n > len(s.codeLines) {
+			continue
+		}
+		if n == line {
+			fmt.Println(snippetColor(fmt.Sprintf("=> %4d: ", n)) + outputColor(s.codeLines[n-1]))
+		} else {
+			fmt.Printf("   %4d: %s\n", n, s.codeLines[n-1])
+		}
+	}
+}
+
+// handleLocals prints the local variables of the current frame.
+func handleLocals() {
+	if debugger == nil {
+		fmt.Println(infoColor("No debugging session is running. Start one with :debug."))
+		return
+	}
+	var out struct{ Variables []dlvVariable }
+	err := debugger.client.Call("RPCServer.ListLocalVars", struct {
+		Scope dlvEvalScope
+		Cfg   dlvLoadConfig
+	}{debugCurrentScope, debugLoadConfig}, &out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("locals: %v", err))
+		return
+	}
+	if len(out.Variables) == 0 {
+		fmt.Println(infoColor("No local variables."))
+		return
+	}
+	var lines []string
+	for _, v := range out.Variables {
+		lines = append(lines, fmt.Sprintf("%s %s = %s", v.Name, infoColor("%s", v.Type), outputColor(formatDebugVariable(v))))
+	}
+	printBoxed("Locals", lines)
+}
+
+// handlePrint evaluates an expression in the current frame.
+func handlePrint(expr string) {
+	if debugger == nil {
+		fmt.Println(infoColor("No debugging session is running. Start one with :debug."))
+		return
+	}
+	if expr == "" {
+		fmt.Println(infoColor("Usage: :print <expression>"))
+		return
+	}
+	var out struct{ Variable *dlvVariable }
+	err := debugger.client.Call("RPCServer.Eval", struct {
+		Scope dlvEvalScope
+		Expr  string
+		Cfg   *dlvLoadConfig
+	}{debugCurrentScope, expr, &debugLoadConfig}, &out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("print: %v", err))
+		return
+	}
+	if out.Variable != nil {
+		fmt.Println(outputColor(formatDebugVariable(*out.Variable)))
+	}
+}
+
+// formatDebugVariable writes a variable loaded by dlv as a Go value.
+func formatDebugVariable(v dlvVariable) string {
+	if v.Unreadable != "" {
+		return "(unreadable " + v.Unreadable + ")"
+	}
+	more := func(loaded int) string {
+		if int64(loaded) < v.Len {
+			return fmt.Sprintf(", ...+%d more", v.Len-int64(loaded))
+		}
+		return ""
+	}
+	switch v.Kind {
+	case reflect.String:
+		s := strconv.Quote(v.Value)
+		if int64(len(v.Value)) < v.Len {
+			s += fmt.Sprintf("...+%d more", v.Len-int64(len(v.Value)))
+		}
+		return s
+	case reflect.Array, reflect.Slice:
+		elems := make([]string, len(v.Children))
+		for i, c := range v.Children {
+			elems[i] = formatDebugVariable(c)
+		}
+		return "[" + strings.Join(elems, ", ") + more(len(v.Children)) + "]"
+	case reflect.Map:
+		var elems []string
+		for i := 0; i+1 < len(v.Children); i += 2 {
+			elems = append(elems, formatDebugVariable(v.Children[i])+": "+formatDebugVariable(v.Children[i+1]))
+		}
+		return "map[" + strings.Join(elems, ", ") + more(len(elems)) + "]"
+	case reflect.Struct:
+		fields := make([]string, len(v.Children))
+		for i, c := range v.Children {
+			fields[i] = c.Name + ": " + formatDebugVariable(c)
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	case reflect.Ptr:
+		if len(v.Children) == 0 || v.Children[0].Addr == 0 {
+			return "nil"
+		}
+		return "&" + formatDebugVariable(v.Children[0])
+	case reflect.Interface:
+		if len(v.Children) == 0 || v.Children[0].Kind == reflect.Invalid {
+			return "nil"
+		}
+		return formatDebugVariable(v.Children[0])
+	case reflect.Invalid:
+		return "nil"
+	}
+	if v.Value == "" {
+		return fmt.Sprintf("%s(%#x)", v.Type, v.Addr)
+	}
+	return v.Value
+}
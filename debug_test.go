@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestGeneratedLine(t *testing.T) {
+	lineMap := []int{0, 0, 3, 0, 1, 2, 0}
+	tests := []struct{ line, want int }{
+		{1, 5},
+		{2, 6},
+		{3, 3},
+		{4, 0},
+	}
+	for _, tt := range tests {
+		if got := generatedLine(lineMap, tt.line); got != tt.want {
+			t.Errorf("generatedLine(%d) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDebugVariable(t *testing.T) {
+	one := dlvVariable{Kind: reflect.Int, Type: "int", Value: "1"}
+	two := dlvVariable{Kind: reflect.Int, Type: "int", Value: "2"}
+	tests := []struct {
+		name string
+		v    dlvVariable
+		want string
+	}{
+		{"int", one, "1"},
+		{"string", dlvVariable{Kind: reflect.String, Value: "a\"b", Len: 3}, `"a\"b"`},
+		{"truncated string", dlvVariable{Kind: reflect.String, Value: "ab", Len: 10}, `"ab"...+8 more`},
+		{"slice", dlvVariable{Kind: reflect.Slice, Len: 2, Children: []dlvVariable{one, two}}, "[1, 2]"},
+		{"truncated slice", dlvVariable{Kind: reflect.Slice, Len: 5, Children: []dlvVariable{one}}, "[1, ...+4 more]"},
+		{"map", dlvVariable{Kind: reflect.Map, Len: 1, Children: []dlvVariable{{Kind: reflect.String, Value: "k", Len: 1}, one}}, `map["k": 1]`},
+		{"struct", dlvVariable{Kind: reflect.Struct, Children: []dlvVariable{{Name: "A", Kind: reflect.Int, Value: "1"}}}, "{A: 1}"},
+		{"pointer", dlvVariable{Kind: reflect.Ptr, Children: []dlvVariable{{Kind: reflect.Int, Value: "1", Addr: 0xc0}}}, "&1"},
+		{"nil pointer", dlvVariable{Kind: reflect.Ptr, Children: []dlvVariable{{Kind: reflect.Int}}}, "nil"},
+		{"interface", dlvVariable{Kind: reflect.Interface, Children: []dlvVariable{two}}, "2"},
+		{"nil interface", dlvVariable{Kind: reflect.Interface}, "nil"},
+		{"unreadable", dlvVariable{Kind: reflect.Int, Unreadable: "bad address"}, "(unreadable bad address)"},
+		{"no value", dlvVariable{Kind: reflect.Func, Type: "func()", Addr: 0x10}, "func()(0x10)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatDebugVariable(tt.v); got != tt.want {
+				t.Errorf("formatDebugVariable() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelocateBreakpoints(t *testing.T) {
+	breakpoints := []debugBreakpoint{{2, "y := 2"}, {3, "println(x, y)"}}
+	tests := []struct {
+		name      string
+		codeLines []string
+		want      []debugBreakpoint
+		notes     int
+	}{
+		{"unchanged", []string{"x := 1", "y := 2", "println(x, y)"}, breakpoints, 0},
+		{"line inserted before", []string{"x := 1", "z := 0", "y := 2", "println(x, y)"}, []debugBreakpoint{{3, "y := 2"}, {4, "println(x, y)"}}, 2},
+		{"line deleted", []string{"x := 1", "println(x, y)"}, []debugBreakpoint{{2, "println(x, y)"}}, 2},
+		{"line changed", []string{"x := 1", "y := 3", "println(x, y)"}, []debugBreakpoint{{3, "println(x, y)"}}, 1},
+		{"nearest line", []string{"y := 2", "x := 1", "println(x, y)", "y := 2"}, []debugBreakpoint{{1, "y := 2"}, {3, "println(x, y)"}}, 1},
+		{"emptied", nil, nil, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notes := relocateBreakpoints(breakpoints, tt.codeLines)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("relocateBreakpoints() = %v, want %v", got, tt.want)
+			}
+			if len(notes) != tt.notes {
+				t.Errorf("relocateBreakpoints() notes = %q, want %d notes", notes, tt.notes)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultDeterministicSeed is the seed of math/rand used by :run --deterministic.
+const defaultDeterministicSeed = 1
+
+// deterministicHarnessTemplate is compiled along with the generated program in
+// deterministic mode. It seeds math/rand and provides the fixed clock used in place
+// of time.Now with --fixed-clock.
+const deterministicHarnessTemplate = `package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+func init() {
+	rand.Seed(%d)
+}
+
+var (
+	goblinClockMu sync.Mutex
+	goblinClock   = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// goblinNow returns a fixed time, moving forward by a millisecond at each call.
+func goblinNow() time.Time {
+	goblinClockMu.Lock()
+	defer goblinClockMu.Unlock()
+	now := goblinClock
+	goblinClock = goblinClock.Add(time.Millisecond)
+	return now
+}
+`
+
+// timeImportNames returns the names the time package is imported with by a program, which
+// is time unless it is renamed, and whether it is imported with a dot.
+func timeImportNames(program string) ([]string, bool) {
+	file, err := parser.ParseFile(token.NewFileSet(), "repl_code.go", program, parser.ImportsOnly)
+	if file == nil {
+		return []string{"time"}, false
+	}
+	var names []string
+	dot := false
+	for _, imp := range file.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path != "time" {
+			continue
+		}
+		switch {
+		case imp.Name == nil:
+			names = append(names, "time")
+		case imp.Name.Name == ".":
+			dot = true
+		case imp.Name.Name != "_":
+			names = append(names, imp.Name.Name)
+		}
+	}
+	if err != nil && len(names) == 0 && !dot {
+		// The imports do not parse, the program fails to compile anyway
+		names = []string{"time"}
+	}
+	return names, dot
+}
+
+// replaceTimeNow replaces the calls to time.Now in a program by calls to goblinNow, the
+// time package being named as it is imported. The program is scanned as Go tokens, so
+// strings and comments are left alone, and the line numbers are unchanged. The imports
+// of time with calls replaced are kept used by declarations added at the end. It returns
+// the new program and the number of calls replaced.
+func replaceTimeNow(program string) (string, int) {
+	names, _ := timeImportNames(program)
+	imported := make(map[string]bool)
+	for _, name := range names {
+		imported[name] = true
+	}
+	src := []byte(program)
+	fset := token.NewFileSet()
+	file := fset.AddFile("repl_code.go", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+
+	type tok struct {
+		offset int
+		tok    token.Token
+		lit    string
+	}
+	var toks []tok
+	for {
+		pos, t, lit := s.Scan()
+		if t == token.EOF {
+			break
+		}
+		toks = append(toks, tok{offset: file.Offset(pos), tok: t, lit: lit})
+	}
+
+	var b strings.Builder
+	last, count := 0, 0
+	replaced := make(map[string]bool)
+	for i := 0; i+4 < len(toks); i++ {
+		if toks[i].tok == token.IDENT && imported[toks[i].lit] &&
+			toks[i+1].tok == token.PERIOD &&
+			toks[i+2].tok == token.IDENT && toks[i+2].lit == "Now" &&
+			toks[i+3].tok == token.LPAREN && toks[i+4].tok == token.RPAREN {
+			// A selector on something else than the package, such as x.time.Now(), is kept
+			if i > 0 && toks[i-1].tok == token.PERIOD {
+				continue
+			}
+			b.WriteString(program[last:toks[i].offset])
+			b.WriteString("goblinNow()")
+			last = toks[i+4].offset + 1
+			count++
+			replaced[toks[i].lit] = true
+			i += 4
+		}
+	}
+	b.WriteString(program[last:])
+	for _, name := range names {
+		if replaced[name] {
+			fmt.Fprintf(&b, "\nvar _ = %s.Now\n", name)
+		}
+	}
+	return b.String(), count
+}
+
+// deterministicSetup prepares a run with --deterministic: it returns the program to run,
+// the harness to compile with it and the environment of the run.
+//
+// Randomness of math/rand is seeded with a fixed value, the program runs on a single
+// thread without asynchronous preemption, and with --fixed-clock, time.Now returns a
+// fixed time moving forward by a millisecond at each call.
+func deterministicSetup(program string, opts runOptions, env []string) (string, string, []string) {
+	if opts.fixedClock {
+		program, _ = replaceTimeNow(program)
+		if _, dot := timeImportNames(program); dot {
+			fmt.Println(infoColor("time is imported with a dot: the calls to Now are not replaced by the fixed clock."))
+		}
+	}
+
+	godebug := "randseednop=0,asyncpreemptoff=1"
+	if current := os.Getenv("GODEBUG"); current != "" {
+		godebug = current + "," + godebug
+	}
+	env = append(env, "GOMAXPROCS=1", "GODEBUG="+godebug)
+
+	return program, fmt.Sprintf(deterministicHarnessTemplate, opts.seed), env
+}
+
+// printDeterministicNote reminds what a deterministic run does not control.
+func printDeterministicNote(opts runOptions) {
+	fmt.Println(infoColor("Deterministic run: math/rand seeded with %d, GOMAXPROCS=1, asynchronous preemption off.", opts.seed))
+	remaining := []string{"map iteration order", "select between ready channels", "math/rand/v2 and crypto/rand", "timers, time.Sleep and time.Since"}
+	if !opts.fixedClock {
+		remaining = append(remaining, "time.Now (use --fixed-clock)")
+	}
+	fmt.Println(infoColor("Still non-deterministic: %s.", strings.Join(remaining, ", ")))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestReplaceTimeNow(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		want    string
+		count   int
+	}{
+		{
+			"call",
+			"package main\nimport \"time\"\nfunc main() { t := time.Now() }",
+			"package main\nimport \"time\"\nfunc main() { t := goblinNow() }\nvar _ = time.Now\n",
+			1,
+		},
+		{
+			"aliased import",
+			"package main\nimport tm \"time\"\nfunc main() { t := tm.Now(); u := time.Now() }",
+			"package main\nimport tm \"time\"\nfunc main() { t := goblinNow(); u := time.Now() }\nvar _ = tm.Now\n",
+			1,
+		},
+		{
+			"string and comment",
+			"package main\nimport \"time\"\n// time.Now()\nfunc main() { s := \"time.Now()\" }",
+			"package main\nimport \"time\"\n// time.Now()\nfunc main() { s := \"time.Now()\" }",
+			0,
+		},
+		{
+			"field selector",
+			"package main\nimport \"time\"\nfunc main() { x.time.Now(); time.Now }",
+			"package main\nimport \"time\"\nfunc main() { x.time.Now(); time.Now }",
+			0,
+		},
+		{
+			"dot import",
+			"package main\nimport . \"time\"\nfunc main() { t := Now() }",
+			"package main\nimport . \"time\"\nfunc main() { t := Now() }",
+			0,
+		},
+		{
+			"not imported",
+			"package main\nfunc main() { t := time.Now() }",
+			"package main\nfunc main() { t := time.Now() }",
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := replaceTimeNow(tt.program)
+			if got != tt.want || count != tt.count {
+				t.Errorf("replaceTimeNow() = %q, %d, want %q, %d", got, count, tt.want, tt.count)
+			}
+			if strings.Count(got, "\n") < strings.Count(tt.program, "\n") {
+				t.Errorf("replaceTimeNow() removed lines")
+			}
+		})
+	}
+}
+
+func TestTimeImportNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		names   string
+		dot     bool
+	}{
+		{"plain", "package main\nimport \"time\"", "time", false},
+		{"renamed", "package main\nimport t \"time\"", "t", false},
+		{"both", "package main\nimport (\n\"time\"\nt \"time\"\n)", "time,t", false},
+		{"dot", "package main\nimport . \"time\"", "", true},
+		{"blank", "package main\nimport _ \"time\"", "", false},
+		{"other package", "package main\nimport \"fmt\"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, dot := timeImportNames(tt.program)
+			if strings.Join(names, ",") != tt.names || dot != tt.dot {
+				t.Errorf("timeImportNames() = %q, %v, want %q, %v", names, dot, tt.names, tt.dot)
+			}
+		})
+	}
+}
+
+// TestDeterministicRun checks that the settings of a deterministic run apply to the
+// program, which is built apart from them.
+func TestDeterministicRun(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	code := "import (\n\t\"fmt\"\n\t\"runtime\"\n\t\"time\"\n)\nfmt.Println(runtime.GOMAXPROCS(0), time.Now().Year())"
+	result, err := executeCode(code, nil, runOptions{deterministic: true, fixedClock: true, seed: defaultDeterministicSeed})
+	if err != nil {
+		t.Fatalf("executeCode() error = %v, output %q", err, result.output)
+	}
+	if result.output != "1 2000\n" {
+		t.Errorf("output = %q, want %q", result.output, "1 2000\n")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxMatchedLines bounds the size of the table matching the lines of a buffer before and
+// after a change, beyond which the lines changed are matched by position only.
+const maxMatchedLines = 1 << 22
+
+// bufferEntries holds the index of the first line of each entry of the buffer, in order.
+// An entry is what was added to the buffer in one go: a line or a block typed, a paste, or
+// a declaration of a loaded file. Commands changing lines leave them in their entry.
+var bufferEntries []int
+
+// entriesSet tells that the last change of the buffer set its entries itself, so that they
+// are not found again from the lines changed.
+var entriesSet bool
+
+// setBufferEntries sets the entries of the buffer changed by an input.
+func setBufferEntries(entries []int) {
+	bufferEntries, entriesSet = entries, true
+}
+
+// splitEntries splits lines into entries as if they were typed one after the other: an
+// entry ends with the line closing its braces, parentheses, raw strings and comments. Blank
+// lines and line comments go with the entry after them, or the last one.
+func splitEntries(lines []string) []int {
+	var entries []int
+	first, content := 0, false
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "//") {
+			content = true
+		}
+		if content && scanEntry(lines[first:i+1]).complete() {
+			entries = append(entries, first)
+			first, content = i+1, false
+		}
+	}
+	if first < len(lines) {
+		if len(entries) == 0 || content {
+			entries = append(entries, first)
+		}
+	}
+	return entries
+}
+
+// matchLines matches the lines of a buffer before a change with its lines after it, as a
+// diff does, ignoring spaces. The lines changed in place, those left between the same lines
+// matched, are matched by position. It returns the index after the change of each line
+// before it, or -1 for the lines removed.
+func matchLines(before, after []string) []int {
+	key := func(line string) string { return strings.Join(strings.Fields(line), " ") }
+	oldKeys, newKeys := make([]string, len(before)), make([]string, len(after))
+	for i, line := range before {
+		oldKeys[i] = key(line)
+	}
+	for j, line := range after {
+		newKeys[j] = key(line)
+	}
+	moved := make([]int, len(before))
+	for i := range moved {
+		moved[i] = -1
+	}
+
+	// The longest common subsequence of the lines, between the lines equal at both ends
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && oldKeys[prefix] == newKeys[prefix] {
+		moved[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		oldKeys[len(before)-1-suffix] == newKeys[len(after)-1-suffix] {
+		moved[len(before)-1-suffix] = len(after) - 1 - suffix
+		suffix++
+	}
+	oldKeys, newKeys = oldKeys[prefix:len(before)-suffix], newKeys[prefix:len(after)-suffix]
+	n, m := len(oldKeys), len(newKeys)
+	if (n+1)*(m+1) <= maxMatchedLines {
+		common := make([]int32, (n+1)*(m+1))
+		at := func(i, j int) int32 { return common[i*(m+1)+j] }
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if oldKeys[i] == newKeys[j] {
+					common[i*(m+1)+j] = at(i+1, j+1) + 1
+				} else {
+					common[i*(m+1)+j] = max(at(i+1, j), at(i, j+1))
+				}
+			}
+		}
+		for i, j := 0, 0; i < n && j < m; {
+			switch {
+			case oldKeys[i] == newKeys[j]:
+				moved[prefix+i] = prefix + j
+				i, j = i+1, j+1
+			case at(i+1, j) >= at(i, j+1):
+				i++
+			default:
+				j++
+			}
+		}
+	}
+
+	// The lines left between two matched lines are matched by position
+	for i, j := 0, 0; i < len(before); {
+		if moved[i] >= 0 {
+			i, j = i+1, moved[i]+1
+			continue
+		}
+		end, next := i, len(after)
+		for end < len(before) && moved[end] < 0 {
+			end++
+		}
+		if end < len(before) {
+			next = moved[end]
+		}
+		for k := i; k < end && j+k-i < next; k++ {
+			moved[k] = j + k - i
+		}
+		i = end
+	}
+	return moved
+}
+
+// updateEntries returns the entries of the buffer after a change made by a command, from
+// its entries and its lines before the change. The lines kept, or changed in place, stay in
+// their entry. The lines added go in the entry they are added to, or are split into new
+// entries when they are added between two entries.
+func updateEntries(entries []int, before, after []string) []int {
+	moved := matchLines(before, after)
+	start := make([]bool, len(after))
+	kept := make([]bool, len(after))
+	for _, j := range moved {
+		if j >= 0 {
+			kept[j] = true
+		}
+	}
+	for k, first := range entries {
+		end := len(before)
+		if k+1 < len(entries) {
+			end = entries[k+1]
+		}
+		for i := first; i < end; i++ {
+			if moved[i] >= 0 {
+				start[moved[i]] = true
+				break
+			}
+		}
+	}
+	for first := 0; first < len(after); {
+		if kept[first] {
+			first++
+			continue
+		}
+		end := first
+		for end < len(after) && !kept[end] {
+			end++
+		}
+		if first == 0 || end == len(after) || start[end] {
+			for _, entry := range splitEntries(after[first:end]) {
+				start[first+entry] = true
+			}
+		}
+		first = end
+	}
+
+	var updated []int
+	for i := range after {
+		if start[i] || i == 0 {
+			updated = append(updated, i)
+		}
+	}
+	return updated
+}
+
+// entryLines returns the first and the last buffer lines of entry n, from 1.
+func entryLines(entries []int, n, size int) (int, int) {
+	last := size
+	if n < len(entries) {
+		last = entries[n]
+	}
+	return entries[n-1] + 1, last
+}
+
+// parseEntryRange parses an entry, or a range of entries, such as #3 or #3-5, into the
+// first and the last buffer lines they cover.
+func parseEntryRange(arg string, entries []int, size int) (int, int, error) {
+	from, to, isRange := strings.Cut(strings.TrimPrefix(arg, "#"), "-")
+	parse := func(s string) (int, error) {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "#"))
+		if err != nil || n < 1 || n > len(entries) {
+			return 0, fmt.Errorf("Invalid entry: %s. Please provide an entry between #1 and #%d.", arg, len(entries))
+		}
+		return n, nil
+	}
+	first, err := parse(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	last := first
+	if isRange {
+		if last, err = parse(to); err != nil {
+			return 0, 0, err
+		}
+		if last < first {
+			return 0, 0, fmt.Errorf("Invalid entry range: %s. The first entry must come before the last one.", arg)
+		}
+	}
+	firstLine, _ := entryLines(entries, first, size)
+	_, lastLine := entryLines(entries, last, size)
+	return firstLine, lastLine, nil
+}
+
+// handleEntries lists the entries of the buffer with the lines they cover and their first
+// line not blank.
+func handleEntries(codeLines []string) {
+	if len(codeLines) == 0 {
+		fmt.Println(infoColor("Code buffer is empty."))
+		return
+	}
+	if len(bufferEntries) == 0 {
+		fmt.Fprintln(os.Stderr, errorColor("The entries of the buffer are unknown."))
+		return
+	}
+	for n := 1; n <= len(bufferEntries); n++ {
+		first, last := entryLines(bufferEntries, n, len(codeLines))
+		text := ""
+		for _, line := range codeLines[first-1 : last] {
+			if text = strings.TrimSpace(line); text != "" {
+				break
+			}
+		}
+		if len(text) > 50 {
+			text = text[:47] + "..."
+		}
+		fmt.Printf("%5s %-12s %s\n", fmt.Sprintf("#%d", n), lineRange(first, last), text)
+	}
+}
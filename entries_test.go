@@ -0,0 +1,112 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []int
+	}{
+		{"statements", []string{"x := 1", "y := 2"}, []int{0, 1}},
+		{"block", []string{"func f() {", "\treturn", "}", "f()"}, []int{0, 3}},
+		{"blank lines and comments go with the next entry", []string{"x := 1", "", "// f does", "func f() {}"}, []int{0, 1}},
+		{"trailing blank lines go with the last entry", []string{"x := 1", "", ""}, []int{0}},
+		{"raw string", []string{"s := `a", "}", "`", "println(s)"}, []int{0, 3}},
+		{"unclosed block", []string{"x := 1", "if x > 0 {"}, []int{0, 1}},
+		{"only blank lines", []string{"", ""}, []int{0}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitEntries(tt.lines); !slices.Equal(got, tt.want) {
+				t.Errorf("splitEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchLines(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after []string
+		want          []int
+	}{
+		{"unchanged", []string{"a", "b"}, []string{"a", "b"}, []int{0, 1}},
+		{"removed", []string{"a", "b", "c"}, []string{"a", "c"}, []int{0, -1, 1}},
+		{"inserted", []string{"a", "c"}, []string{"a", "b", "c"}, []int{0, 2}},
+		{"changed in place", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []int{0, 1, 2}},
+		{"reindented", []string{"if x {", "println(x)", "}"}, []string{"if x {", "\tprintln(x)", "}"}, []int{0, 1, 2}},
+		{"joined", []string{"a", "b", "c", "d"}, []string{"a", "b c", "d"}, []int{0, 1, -1, 2}},
+		{"moved", []string{"a", "b", "c"}, []string{"b", "c", "a"}, []int{-1, 0, 1}},
+		{"replaced", []string{"a"}, []string{"x", "y"}, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchLines(tt.before, tt.after); !slices.Equal(got, tt.want) {
+				t.Errorf("matchLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateEntries(t *testing.T) {
+	buffer := []string{"x := 1", "func f() {", "\tprintln(x)", "}", "f()"}
+	entries := []int{0, 1, 4}
+	tests := []struct {
+		name  string
+		after []string
+		want  []int
+	}{
+		{"unchanged", buffer, entries},
+		{"line of an entry deleted", []string{"x := 1", "func f() {", "}", "f()"}, []int{0, 1, 3}},
+		{"first line of an entry deleted", []string{"func f() {", "\tprintln(x)", "}", "f()"}, []int{0, 3}},
+		{"entry deleted", []string{"x := 1", "f()"}, []int{0, 1}},
+		{"line changed", []string{"x := 2", "func f() {", "\tprintln(x)", "}", "f()"}, entries},
+		{"line added to an entry", []string{"x := 1", "func f() {", "\tprintln(x)", "\tprintln(2)", "}", "f()"}, []int{0, 1, 5}},
+		{"lines added between entries", []string{"x := 1", "y := 2", "z := 3", "func f() {", "\tprintln(x)", "}", "f()"}, []int{0, 1, 2, 3, 6}},
+		{"lines added at the end", append(slices.Clone(buffer), "g()", "h()"), []int{0, 1, 4, 5, 6}},
+		{"entries joined", []string{"x := 1", "func f() {", "\tprintln(x)", "} f()"}, []int{0, 1}},
+		{"emptied", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := updateEntries(entries, buffer, tt.after); !slices.Equal(got, tt.want) {
+				t.Errorf("updateEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEntryRange(t *testing.T) {
+	entries := []int{0, 1, 4}
+	tests := []struct {
+		arg         string
+		first, last int
+		wantErr     bool
+	}{
+		{"#1", 1, 1, false},
+		{"#2", 2, 4, false},
+		{"#3", 5, 6, false},
+		{"#2-3", 2, 6, false},
+		{"#1-#2", 1, 4, false},
+		{"#0", 0, 0, true},
+		{"#4", 0, 0, true},
+		{"#3-1", 0, 0, true},
+		{"#x", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			first, last, err := parseEntryRange(tt.arg, entries, 6)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEntryRange(%q) error = %v, want error %v", tt.arg, err, tt.wantErr)
+			}
+			if first != tt.first || last != tt.last {
+				t.Errorf("parseEntryRange(%q) = %d, %d, want %d, %d", tt.arg, first, last, tt.first, tt.last)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// entryIndent is the indentation added for each level of nesting of an entry.
+const entryIndent = "    "
+
+// entryState is what the lines of an entry being typed leave open.
+type entryState struct {
+	depth     int  // Open braces, parentheses and brackets
+	rawString bool // Inside a raw string literal
+	comment   bool // Inside a general comment
+}
+
+// scanEntry returns what the lines of an entry leave open. The lines are scanned as Go
+// tokens, so that braces in strings and comments are not counted.
+func scanEntry(lines []string) entryState {
+	var st entryState
+	src := []byte(strings.Join(lines, "\n"))
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", -1, len(src)), src, func(pos token.Position, msg string) {
+		switch msg {
+		case "raw string literal not terminated":
+			st.rawString = true
+		case "comment not terminated":
+			st.comment = true
+		}
+	}, scanner.ScanComments)
+	for {
+		_, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return st
+		case token.LBRACE, token.LPAREN, token.LBRACK:
+			st.depth++
+		case token.RBRACE, token.RPAREN, token.RBRACK:
+			st.depth--
+		}
+	}
+}
+
+// inLiteral reports whether the next line is inside a raw string or a comment, where it
+// is taken as it is, even when it starts with ':'.
+func (st entryState) inLiteral() bool {
+	return st.rawString || st.comment
+}
+
+// complete reports whether the entry is balanced and can be added to the buffer.
+func (st entryState) complete() bool {
+	return st.depth <= 0 && !st.inLiteral()
+}
+
+// prompt returns the continuation prompt of an entry, showing its nesting depth.
+func (st entryState) prompt() string {
+	switch {
+	case st.rawString:
+		return " `-> "
+	case st.comment:
+		return " *-> "
+	}
+	return fmt.Sprintf("%2d-> ", st.depth)
+}
+
+// indent returns the indentation pre-filled for the next line of an entry. Nothing is
+// pre-filled inside a raw string, where it would change the string.
+func (st entryState) indent() string {
+	if st.inLiteral() || st.depth <= 0 {
+		return ""
+	}
+	return strings.Repeat(entryIndent, st.depth)
+}
+
+// dedent removes a level of the pre-filled indentation from a line closing a block.
+func (st entryState) dedent(input string) string {
+	indent := st.indent()
+	if indent == "" || !strings.HasPrefix(input, indent) {
+		return input
+	}
+	rest := strings.TrimLeft(input, " \t")
+	if rest == "" || !strings.ContainsRune("})]", rune(rest[0])) {
+		return input
+	}
+	return strings.TrimPrefix(input, entryIndent)
+}
+
+// addEntryLine adds lines to the entry being typed. Once the braces, parentheses, raw
+// strings and comments of the entry are closed, the entry is appended to the buffer as a
+// whole, going through the redefinition semantics and the live check. It returns the
+// buffer and the entry still being typed.
+func addEntryLine(rl *readline.Instance, codeLines []string, entry []string, lines ...string) ([]string, []string) {
+	entry = append(entry, lines...)
+	if !scanEntry(entry).complete() {
+		return codeLines, entry
+	}
+
+	// A rejected entry leaves the buffer as it was, with the declarations it redefines
+	previous, dirty := slices.Clone(codeLines), bufferDirty
+	codeLines, entry = redefine(rl, codeLines, entry)
+	first := len(codeLines) + 1
+	codeLines = append(codeLines, entry...)
+	if kept := checkEntry(rl.Stdout(), codeLines, first); kept < len(codeLines) {
+		if len(previous) != first-1 {
+			fmt.Println(infoColor("The previous declaration is kept."))
+		}
+		bufferDirty = dirty
+		return previous, nil
+	}
+	// The lines redefined leave their entries, and the new lines are an entry of their own
+	setBufferEntries(append(updateEntries(bufferEntries, previous, codeLines[:first-1]), first-1))
+	bufferDirty = true
+	return codeLines, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestScanEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		want     entryState
+		complete bool
+		indent   string
+	}{
+		{"statement", []string{"x := 1"}, entryState{}, true, ""},
+		{"open block", []string{"if x {"}, entryState{depth: 1}, false, entryIndent},
+		{"nested blocks", []string{"func f() {", "for {"}, entryState{depth: 2}, false, entryIndent + entryIndent},
+		{"closed block", []string{"if x {", "y()", "}"}, entryState{}, true, ""},
+		{"call arguments", []string{"f(a,"}, entryState{depth: 1}, false, entryIndent},
+		{"brace in a string", []string{`s := "{"`}, entryState{}, true, ""},
+		{"brace in a comment", []string{"x := 1 // {"}, entryState{}, true, ""},
+		{"open raw string", []string{"s := `a {"}, entryState{rawString: true}, false, ""},
+		{"closed raw string", []string{"s := `a", "b`"}, entryState{}, true, ""},
+		{"open comment", []string{"/* a"}, entryState{comment: true}, false, ""},
+		{"extra closing brace", []string{"}"}, entryState{depth: -1}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := scanEntry(tt.lines)
+			if st != tt.want {
+				t.Errorf("scanEntry() = %+v, want %+v", st, tt.want)
+			}
+			if st.complete() != tt.complete {
+				t.Errorf("complete() = %v, want %v", st.complete(), tt.complete)
+			}
+			if st.indent() != tt.indent {
+				t.Errorf("indent() = %q, want %q", st.indent(), tt.indent)
+			}
+		})
+	}
+}
+
+func TestEntryDedent(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry []string
+		input string
+		want  string
+	}{
+		{"closing brace", []string{"if x {"}, entryIndent + "}", "}"},
+		{"closing brace of a nested block", []string{"if x {", entryIndent + "for {"}, entryIndent + entryIndent + "}", entryIndent + "}"},
+		{"closing parenthesis", []string{"f("}, entryIndent + ")", ")"},
+		{"statement", []string{"if x {"}, entryIndent + "y()", entryIndent + "y()"},
+		{"indentation removed", []string{"if x {"}, "}", "}"},
+		{"raw string", []string{"s := `a"}, "}", "}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanEntry(tt.entry).dedent(tt.input); got != tt.want {
+				t.Errorf("dedent(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
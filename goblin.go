@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
@@ -119,9 +120,28 @@ func main() {
 }
 `
 
-func separateCodeParts(code string) (userImports, topLevelDeclarations, statements string) {
-	var userImportsBuilder, topLevelDeclarationsBuilder, statementsBuilder strings.Builder
+// codePart identifies the section of the generated program a buffer line is placed in.
+type codePart int
+
+const (
+	partNone      codePart = iota // Not copied to the program (blank lines, import parentheses)
+	partImport                    // Import path inside the import block
+	partDecl                      // Global variables, constants, types, and functions
+	partStatement                 // Statements run in main
+)
+
+// codeLine is a buffer line as classified by splitCodeLines.
+type codeLine struct {
+	Num  int      // Line number in the buffer, starting at 1
+	Part codePart // Section of the program the line belongs to
+	Text string   // Text written to the program for this line
+}
+
+// splitCodeLines classifies each line of the buffer as an import, a top-level
+// declaration or a statement, keeping track of its line number.
+func splitCodeLines(code string) []codeLine {
 	lines := strings.Split(code, "\n")
+	result := make([]codeLine, 0, len(lines))
 
 	// Regex for identifying different code constructs
 	importSingleRegex := regexp.MustCompile(`^import\s+(\"?[\w/.]+\"?)$`)
@@ -134,35 +154,41 @@ func separateCodeParts(code string) (userImports, topLevelDeclarations, statemen
 	inFuncDecl := false
 	braceCount := 0
 
-	for _, line := range lines {
+	for i, line := range lines {
 		trimmedLine := strings.TrimSpace(line)
+		add := func(part codePart, text string) {
+			result = append(result, codeLine{Num: i + 1, Part: part, Text: text})
+		}
 
 		// Skip empty lines at the top level, they don't affect parsing logic
 		if trimmedLine == "" && !inImportBlock && !inGlobalDeclBlock && !inFuncDecl {
+			add(partNone, line)
 			continue
 		}
 
 		// --- Handle Import Blocks ---
 		if importGroupRegex.MatchString(trimmedLine) {
 			inImportBlock = true
-			braceCount = 1 // Start of import block
-			continue       // Do not write "import (" to userImportsBuilder
+			braceCount = 1      // Start of import block
+			add(partNone, line) // Do not write "import (" to the imports
+			continue
 		}
 		if inImportBlock {
 			braceCount += strings.Count(line, "(")
 			braceCount -= strings.Count(line, ")")
 			if braceCount <= 0 { // End of import block
 				inImportBlock = false
-				braceCount = 0 // Reset brace count
-				continue       // Do not write ")" to userImportsBuilder
+				braceCount = 0      // Reset brace count
+				add(partNone, line) // Do not write ")" to the imports
+				continue
 			}
 			// This is an import path within a group
-			userImportsBuilder.WriteString(line + "\n")
+			add(partImport, line)
 			continue
 		}
 		if matches := importSingleRegex.FindStringSubmatch(trimmedLine); len(matches) > 1 {
 			// This is a single-line import, extract the path and format it
-			userImportsBuilder.WriteString("\t" + matches[1] + "\n")
+			add(partImport, "\t"+matches[1])
 			continue
 		}
 
@@ -171,17 +197,17 @@ func separateCodeParts(code string) (userImports, topLevelDeclarations, statemen
 			// Check for multi-line var/const/type blocks
 			if strings.HasSuffix(trimmedLine, "(") { // e.g., var (
 				inGlobalDeclBlock = true
-				topLevelDeclarationsBuilder.WriteString(line + "\n")
+				add(partDecl, line)
 				braceCount += strings.Count(line, "(")
 				braceCount -= strings.Count(line, ")")
 				continue
 			} else { // Single line var/const/type
-				topLevelDeclarationsBuilder.WriteString(line + "\n")
+				add(partDecl, line)
 				continue
 			}
 		}
 		if inGlobalDeclBlock {
-			topLevelDeclarationsBuilder.WriteString(line + "\n")
+			add(partDecl, line)
 			braceCount += strings.Count(line, "(")
 			braceCount -= strings.Count(line, ")")
 			if braceCount <= 0 {
@@ -194,13 +220,18 @@ func separateCodeParts(code string) (userImports, topLevelDeclarations, statemen
 		// --- Handle Function Declarations ---
 		if !inImportBlock && !inGlobalDeclBlock && funcDeclStartRegex.MatchString(trimmedLine) {
 			inFuncDecl = true
-			topLevelDeclarationsBuilder.WriteString(line + "\n")
+			add(partDecl, line)
 			braceCount += strings.Count(line, "{")
 			braceCount -= strings.Count(line, "}")
+			if braceCount <= 0 && strings.Contains(line, "{") {
+				// The whole function fits on this line
+				inFuncDecl = false
+				braceCount = 0
+			}
 			continue
 		}
 		if inFuncDecl {
-			topLevelDeclarationsBuilder.WriteString(line + "\n")
+			add(partDecl, line)
 			braceCount += strings.Count(line, "{")
 			braceCount -= strings.Count(line, "}")
 			if braceCount <= 0 {
@@ -212,52 +243,355 @@ func separateCodeParts(code string) (userImports, topLevelDeclarations, statemen
 
 		// --- Handle Statements (everything else) ---
 		if trimmedLine != "" {
-			statementsBuilder.WriteString(line + "\n")
+			add(partStatement, line)
+		} else {
+			add(partNone, line)
 		}
 	}
 
+	return result
+}
+
+func separateCodeParts(code string) (userImports, topLevelDeclarations, statements string) {
+	var userImportsBuilder, topLevelDeclarationsBuilder, statementsBuilder strings.Builder
+	for _, cl := range splitCodeLines(code) {
+		switch cl.Part {
+		case partImport:
+			userImportsBuilder.WriteString(cl.Text + "\n")
+		case partDecl:
+			topLevelDeclarationsBuilder.WriteString(cl.Text + "\n")
+		case partStatement:
+			statementsBuilder.WriteString(cl.Text + "\n")
+		}
+	}
 	return userImportsBuilder.String(), topLevelDeclarationsBuilder.String(), statementsBuilder.String()
 }
 
+// runOptions holds the modes selected with the flags of :run.
+type runOptions struct {
+	stats         bool     // Report runtime statistics once the statements of main are done
+	deterministic bool     // Make the run as reproducible as possible, see deterministicSetup
+	fixedClock    bool     // Replace the calls to time.Now by a fixed clock
+	seed          int64    // Seed of math/rand in deterministic mode
+	watch         []string // Variables whose assignments in main are printed
+	traceVars     bool     // Print the assignments to every variable in main
+	annotate      bool     // Attribute each piece of output to the buffer line that wrote it
+	keep          []string // Variables saved by a run and restored by the next ones
+}
+
+// runResult holds what a run of the buffer produced.
+type runResult struct {
+	output   string
+	stats    *runStats       // Only set when running with --stats
+	segments []outputSegment // Output split by buffer line, only set when running with --annotate
+	notes    []string        // What was done for the kept variables
+}
+
+// parseRunFlags extracts the flags of :run placed before the program arguments. The first
+// argument which is not one of them starts the program arguments, such as --verbose in
+// :run --stats --verbose. A "--" ends the flags, so that arguments named like them can be
+// passed to the program.
+func parseRunFlags(args []string) (runOptions, []string, error) {
+	opts := runOptions{seed: defaultDeterministicSeed}
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		flag, value, hasValue := strings.Cut(args[0], "=")
+		switch flag {
+		case "--":
+			return opts, args[1:], nil
+		case "--stats":
+			opts.stats = true
+		case "--annotate":
+			opts.annotate = true
+		case "--deterministic":
+			opts.deterministic = true
+		case "--fixed-clock":
+			opts.deterministic = true
+			opts.fixedClock = true
+		case "--seed":
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if !hasValue || err != nil {
+				return opts, nil, fmt.Errorf("invalid seed '%s'", value)
+			}
+			opts.deterministic = true
+			opts.seed = seed
+		default:
+			return opts, args, nil
+		}
+		args = args[1:]
+	}
+	return opts, args, nil
+}
+
+// runProgram is the program compiled for a run of the buffer.
+type runProgram struct {
+	code      string            // Source of repl_code.go
+	lineMap   []int             // Buffer line of each line of code
+	harnesses map[string]string // Files compiled along with it, by name
+	env       []string          // Variables added to the environment of the run
+	keep      *keepRun          // Variables saved and restored, when kept
+}
+
+// prepareProgram wraps the buffer in the template and instruments it for the modes of
+// opts. tmpDir is the directory the program is run from.
+func prepareProgram(code string, opts runOptions, tmpDir string) runProgram {
+	p := runProgram{harnesses: map[string]string{}}
+	p.code, p.lineMap = generateProgramMap(code)
+
+	if len(opts.keep) > 0 {
+		var harness string
+		p.code, harness, p.keep = keepSetup(p.code, p.lineMap, opts.keep)
+		if harness != "" {
+			p.harnesses["goblin_keep.go"] = harness
+		}
+	}
+	if len(opts.watch) > 0 || opts.traceVars {
+		// Code that does not parse is run as is, so that the compiler reports the errors
+		if instrumented, err := instrumentAssignments(p.code, p.lineMap, opts.watch, opts.traceVars); err == nil {
+			p.code = instrumented
+			p.harnesses["goblin_watch.go"] = watchHarness
+		}
+	}
+	if opts.annotate {
+		if instrumented, err := instrumentLines(p.code, p.lineMap); err == nil {
+			p.code = instrumented
+			p.harnesses["goblin_annotate.go"] = annotateHarness
+		}
+	}
+	if opts.stats {
+		p.harnesses["goblin_stats.go"] = statsHarness
+		p.env = append(p.env, "GOBLIN_STATS_FILE="+tmpDir+"/stats.json")
+		p.code = deferInMain(p.code, "goblinStatsReport")
+	}
+	if opts.deterministic {
+		var harness string
+		p.code, harness, p.env = deterministicSetup(p.code, opts, p.env)
+		p.harnesses["goblin_deterministic.go"] = harness
+	}
+	return p
+}
+
 // executeCode takes the accumulated user code, separates declarations from statements,
 // wraps them in the template, writes to a temporary file, and executes it.
-func executeCode(code string, args []string) (string, error) {
-	userImports, topLevelDeclarations, statements := separateCodeParts(code)
-
-	// 1. Fill the template with the separated code
-	fullCode := fmt.Sprintf(codeTemplate, userImports, topLevelDeclarations, statements)
+func executeCode(code string, args []string, opts runOptions) (runResult, error) {
+	var result runResult
 
-	// 2. Create a temporary file to hold the code
+	// 1. Create a temporary file to hold the code
 	tmpDir, err := ioutil.TempDir("", "gorepl_tmp")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
+		return result, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer os.RemoveAll(tmpDir) // Clean up the directory and contents afterwards
 
 	tmpFilePath := tmpDir + "/repl_code.go"
+	files := []string{tmpFilePath}
+
+	// 2. Fill the template with the separated code
+	program := prepareProgram(code, opts, tmpDir)
+	fullCode, lineMap, harnesses, env, keep := program.code, program.lineMap, program.harnesses, program.env, program.keep
+	if keep != nil {
+		result.notes = keep.notes
+	}
 
 	// 3. Write code to the temporary file
 	if err := ioutil.WriteFile(tmpFilePath, []byte(fullCode), 0644); err != nil {
-		return "", fmt.Errorf("failed to write code to temp file: %w", err)
+		return result, fmt.Errorf("failed to write code to temp file: %w", err)
+	}
+	for name, harness := range harnesses {
+		harnessPath := tmpDir + "/" + name
+		if err := ioutil.WriteFile(harnessPath, []byte(harness), 0644); err != nil {
+			return result, fmt.Errorf("failed to write code to temp file: %w", err)
+		}
+		files = append(files, harnessPath)
 	}
 
-	// 4. Execute the code using 'go run'
-	cmdArgs := append([]string{"run", tmpFilePath}, args...)
-	cmd := exec.Command("go", cmdArgs...)
-
+	// 4. Build the code, then run it: the environment of the run, such as GOMAXPROCS=1
+	// in deterministic mode, is not the one of the toolchain
+	binPath := tmpDir + "/repl_code"
+	build := exec.Command("go", append([]string{"build", "-o", binPath}, files...)...)
 	// We keep GOWORK=off to prevent conflicts with Go Workspaces.
-	cmd.Env = append(os.Environ(), "GOWORK=off")
+	build.Env = append(os.Environ(), "GOWORK=off")
+	if output, err := build.CombinedOutput(); err != nil {
+		result.output = string(output)
+		if keep != nil {
+			keepFinish(keep, false)
+		}
+		return result, err
+	}
+	cmd := exec.Command(binPath, args...)
+	cmd.Env = append(os.Environ(), env...)
 
 	// Capture combined output (stdout and stderr)
 	output, err := cmd.CombinedOutput()
+	result.output = string(output)
+	if opts.annotate {
+		result.output, result.segments = splitAnnotatedOutput(result.output)
+	}
+
+	if keep != nil {
+		keepFinish(keep, err == nil)
+	}
 
-	// 5. Check if the 'go run' command itself failed
+	if opts.stats {
+		result.stats, _ = readRunStats(tmpDir+"/stats.json", lineMap)
+	}
+
+	// 5. Check if the program failed
 	if exitErr, ok := err.(*exec.ExitError); ok {
 		// Compilation or runtime error happened in the user's code.
-		return string(output), exitErr
+		return result, exitErr
+	}
+
+	return result, nil
+}
+
+// generateProgram wraps the code buffer into the complete Go program built by executeCode.
+func generateProgram(code string) string {
+	userImports, topLevelDeclarations, statements := separateCodeParts(code)
+	return fmt.Sprintf(codeTemplate, userImports, topLevelDeclarations, statements)
+}
+
+// generateProgramMap returns the same program as generateProgram, along with the
+// buffer line number of each line of the program (0 for lines of the template).
+func generateProgramMap(code string) (string, []int) {
+	var sections [3]strings.Builder
+	var sectionLines [3][]int
+	for _, cl := range splitCodeLines(code) {
+		if cl.Part == partNone {
+			continue
+		}
+		idx := int(cl.Part) - int(partImport)
+		sections[idx].WriteString(cl.Text + "\n")
+		sectionLines[idx] = append(sectionLines[idx], cl.Num)
 	}
 
-	return string(output), nil
+	var program strings.Builder
+	var lineMap []int
+	templateParts := strings.Split(codeTemplate, "%s")
+	for i, part := range templateParts {
+		program.WriteString(part)
+		for n := strings.Count(part, "\n"); n > 0; n-- {
+			lineMap = append(lineMap, 0)
+		}
+		if i < len(sections) {
+			program.WriteString(sections[i].String())
+			lineMap = append(lineMap, sectionLines[i]...)
+		}
+	}
+	// The last line of the template has no newline
+	lineMap = append(lineMap, 0)
+	return program.String(), lineMap
+}
+
+// bufferLine maps a line of the generated program back to the buffer, returning 0
+// when the line comes from the template.
+func bufferLine(lineMap []int, generatedLine int) int {
+	if generatedLine < 1 || generatedLine > len(lineMap) {
+		return 0
+	}
+	return lineMap[generatedLine-1]
+}
+
+// buildProgram compiles a generated program into an executable inside a new temporary
+// directory, passing buildFlags to 'go build'. It returns the directory, which the
+// caller must remove, the path of the binary and the compiler output.
+func buildProgram(program string, buildFlags []string) (tmpDir string, binPath string, output string, err error) {
+	return buildProgramFiles(program, nil, buildFlags, nil)
+}
+
+// buildProgramFiles works like buildProgram, compiling extraFiles (file name to content)
+// in the same package as the generated program and adding buildEnv to the environment
+// of 'go build'.
+func buildProgramFiles(program string, extraFiles map[string]string, buildFlags []string, buildEnv []string) (tmpDir string, binPath string, output string, err error) {
+	tmpDir, err = ioutil.TempDir("", "gorepl_tmp")
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	files := map[string]string{"repl_code.go": program}
+	for name, content := range extraFiles {
+		files[name] = content
+	}
+	srcPaths := []string{filepath.Join(tmpDir, "repl_code.go")}
+	for name, content := range files {
+		srcPath := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(srcPath, []byte(content), 0644); err != nil {
+			os.RemoveAll(tmpDir)
+			return "", "", "", fmt.Errorf("failed to write code to temp file: %w", err)
+		}
+		if name != "repl_code.go" {
+			srcPaths = append(srcPaths, srcPath)
+		}
+	}
+
+	binPath = filepath.Join(tmpDir, "repl_code")
+	cmdArgs := append([]string{"build", "-o", binPath}, buildFlags...)
+	cmdArgs = append(cmdArgs, srcPaths...)
+	cmd := exec.Command("go", cmdArgs...)
+	cmd.Dir = tmpDir
+	cmd.Env = append(append(os.Environ(), "GOWORK=off"), buildEnv...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", "", string(out), err
+	}
+	return tmpDir, binPath, string(out), nil
+}
+
+// mainFuncLine is the line opening main in the generated program, as written by codeTemplate.
+const mainFuncLine = "// Statements\nfunc main() {"
+
+// deferInMain makes main defer the call to fn before running the statements of the
+// buffer. The call is added on the line opening main so the line numbers are unchanged.
+func deferInMain(program string, fn string) string {
+	return strings.Replace(program, mainFuncLine, mainFuncLine+" defer "+fn+"();", 1)
+}
+
+// boxLines returns a header carrying title and a footer, both spanning the width of the terminal.
+func boxLines(title string) (string, string) {
+	fd := int(os.Stdout.Fd())
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		// Fallback to a default width if getting terminal size fails
+		width = 80
+	}
+
+	title = " " + title + " "
+	padding := (width - len(title)) / 2
+	if padding < 0 {
+		padding = 0
+	}
+	rest := width - padding - len(title)
+	if rest < 0 {
+		rest = 0
+	}
+
+	header := strings.Repeat("-", padding) + title + strings.Repeat("-", rest)
+	footer := strings.Repeat("-", width)
+	return header, footer
+}
+
+// printBoxed prints lines between a header carrying title and a footer.
+func printBoxed(title string, lines []string) {
+	header, footer := boxLines(title)
+	var b strings.Builder
+	b.WriteString(infoColor(header) + "\n")
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString(infoColor(footer) + "\n")
+	page(b.String())
+}
+
+// printOutput prints the output of a program run between an "Output" header and a footer,
+// truncated to the max output setting.
+func printOutput(output string) {
+	header, footer := boxLines("Output")
+	output, note := limitOutput(output)
+	page(infoColor(header) + "\n" + outputColor(output) + infoColor(footer) + "\n")
+	if note != "" {
+		fmt.Println(infoColor("%s", note))
+	}
 }
 
 // handleList lists all saved files in the REPL_SAVES_DIR.
@@ -360,6 +694,7 @@ func handleLoad(codeLines *[]string, args []string) {
 
 	// Clear and set the new content
 	*codeLines = strings.Split(string(data), "\n")
+	setBufferEntries(splitEntries(*codeLines))
 
 	lastLoadedFilePath = filePath // Store the last loaded file path
 	currentSnippetName = strings.TrimSuffix(filepath.Base(filePath), ".go")
@@ -369,6 +704,11 @@ func handleLoad(codeLines *[]string, args []string) {
 
 // handleExport exports the current code buffer to a full Go source file.
 func handleExport(code string, args []string) {
+	if len(args) == 1 && args[0] == "--preview" {
+		lines := strings.Split(generateProgram(code), "\n")
+		page(formatHighlighted(lines, 1, len(lines)))
+		return
+	}
 	outputPath := ""
 
 	if len(args) == 0 {
@@ -388,11 +728,8 @@ func handleExport(code string, args []string) {
 		return
 	}
 
-	// Separate code parts
-	userImports, topLevelDeclarations, statements := separateCodeParts(code)
-
 	// Fill the template with the separated code
-	fullCode := fmt.Sprintf(codeTemplate, userImports, topLevelDeclarations, statements)
+	fullCode := generateProgram(code)
 
 	// Ensure the directory exists
 	dir := filepath.Dir(outputPath)
@@ -467,9 +804,18 @@ func handleRename(args []string) {
 		return
 	}
 
+	// Move the test cases along with the snippet
+	oldCasesPath, _ := casesFilePath()
+
 	lastLoadedFilePath = newFilePath
 	currentSnippetName = strings.TrimSuffix(newFilename, ".go")
 	fmt.Println(successColor("Snippet successfully renamed to '%s'.", newFilename))
+
+	if newCasesPath, err := casesFilePath(); err == nil && oldCasesPath != "" {
+		if err := os.Rename(oldCasesPath, newCasesPath); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, errorColor("Error renaming test cases file: %v", err))
+		}
+	}
 }
 
 // handleTidy formats the current code buffer using go/format.
@@ -554,22 +900,37 @@ func main() {
 
 // handleEdit opens the current code buffer in an external editor.
 func handleEdit(codeLines *[]string) {
+	data, ok := editLines(*codeLines)
+	if !ok {
+		return
+	}
+
+	// Reset the buffer and write the new content
+	*codeLines = strings.Split(data, "\n")
+
+	fmt.Println(successColor("Buffer updated from editor."))
+
+}
+
+// editLines opens lines in an external editor and returns the content of the file once
+// the editor is closed.
+func editLines(lines []string) (string, bool) {
 	// 1. Create a temporary file with a .go extension
 	tmpfile, err := ioutil.TempFile("", "goblin-*.go")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errorColor("Error creating temporary file: %v", err))
-		return
+		return "", false
 	}
 	defer os.Remove(tmpfile.Name()) // Clean up the file afterwards
 
-	// 2. Write the current buffer to the temporary file
-	if _, err := tmpfile.WriteString(strings.Join(*codeLines, "\n")); err != nil {
+	// 2. Write the lines to the temporary file
+	if _, err := tmpfile.WriteString(strings.Join(lines, "\n")); err != nil {
 		fmt.Fprintln(os.Stderr, errorColor("Error writing to temporary file: %v", err))
-		return
+		return "", false
 	}
 	if err := tmpfile.Close(); err != nil {
 		fmt.Fprintln(os.Stderr, errorColor("Error closing temporary file: %v", err))
-		return
+		return "", false
 	}
 
 	// 3. Get the user's preferred editor
@@ -587,21 +948,16 @@ func handleEdit(codeLines *[]string) {
 
 	if err := cmd.Run(); err != nil {
 		fmt.Fprintln(os.Stderr, errorColor("Error opening editor '%s': %v", editor, err))
-		return
+		return "", false
 	}
 
-	// 5. Read the modified content back into the buffer
+	// 5. Read the modified content back
 	data, err := ioutil.ReadFile(tmpfile.Name())
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errorColor("Error reading modified file: %v", err))
-		return
+		return "", false
 	}
-
-	// 6. Reset the buffer and write the new content
-	*codeLines = strings.Split(string(data), "\n")
-
-	fmt.Println(successColor("Buffer updated from editor."))
-
+	return string(data), true
 }
 
 // handleSys executes a system command with real-time output,
@@ -794,9 +1150,18 @@ func handleHelp() {
 
 	fmt.Println(infoColor("\n🐗 Goblin %s - Commands summary :", version.String()))
 	fmt.Println(":run [args...]           - Execute the current Go code in the buffer with optional arguments.")
+	fmt.Println(":run --stats [args...]   - Execute the buffer and report goroutines left alive, allocations, GC and time.")
+	fmt.Println(":run --annotate          - Execute the buffer and show each output line next to the code that printed it.")
+	fmt.Println(":run --deterministic     - Execute the buffer with a fixed seed and GOMAXPROCS=1 (--seed=N, --fixed-clock).")
 	fmt.Println(":sys <command> [args...] - Execute a system command.")
 	fmt.Println(":clear                   - Clear the current code buffer.")
-	fmt.Println(":show                    - Display the current content of the code buffer.")
+	fmt.Println(":show [<a>-<b>|<func>]   - Display the code buffer, a range of lines or a declaration.")
+	fmt.Println(":entries                 - List the entries of the buffer, #1 being the first. Ranges take #<n> for its lines.")
+	fmt.Println(":source [--flags]        - Print the program :run compiles for the buffer, with the same flags.")
+	fmt.Println(":explain                 - Show whether each line is an import, a declaration or a statement of main.")
+	fmt.Println(":outline                 - List the imports and declarations of the buffer with their lines.")
+	fmt.Println(":goto <name>             - Edit the declaration of a function, method or type in the external editor.")
+	fmt.Println(":output [pager|max] ...  - Page long output (pager on|off), or truncate run output (max <lines>|off).")
 	fmt.Println(":tidy                    - Format the code in the buffer.")
 	fmt.Println(":list                    - List all saved code snippets.")
 	fmt.Println(":save <file>             - Save the current code buffer to a file.")
@@ -804,10 +1169,41 @@ func handleHelp() {
 	fmt.Println(":load <file>             - Load code from a file into the buffer, replacing current content.")
 	fmt.Println(":rename <new_name>       - Rename the current snippet.")
 	fmt.Println(":export <filepath>       - Export the current code buffer to a full Go source file.")
+	fmt.Println(":export --preview        - Show the Go source file the buffer would be exported to.")
 	fmt.Println(":edit                    - Open the current code buffer in an external editor for modification.")
-	fmt.Println(":u(ndo)                  - Remove the last entry from the buffer.")
-	fmt.Println(":d(elete) <line>         - Delete a specific line from the buffer by its number.")
+	fmt.Println(":u(ndo), :redo           - Undo the last change of the buffer (an entry or a command), or redo it.")
+	fmt.Println(":history buffer          - List the changes of the buffer that :undo and :redo go through.")
+	fmt.Println(":d(elete) <line>|<a>-<b> - Delete a line or a range of lines from the buffer, such as :d 3-7.")
 	fmt.Println(":i(nsert) <line>         - Insert an empty line before the provided line number.")
+	fmt.Println(":e <line>                - Edit a line, its current content being pre-filled at the prompt.")
+	fmt.Println(":a <line>                - Insert the lines entered after a line (0 for the top), up to a blank line.")
+	fmt.Println(":m <a>[-<b>] <line>      - Move lines after a line (0 for the top), such as :m 3-5 10.")
+	fmt.Println(":c <a>[-<b>] <line>      - Copy lines after a line (0 for the top), such as :c 3-5 10.")
+	fmt.Println(":j <a>[-<b>]             - Join lines into one, or a line with the next one.")
+	fmt.Println(":find <regex>            - List the lines matching a regular expression.")
+	fmt.Println(":[a-b]s/<re>/<new>/[g]   - Substitute the first (or with g all) matches on lines, after a preview.")
+	fmt.Println(":case add [limit]        - Record a stdin input and its expected output for the current snippet.")
+	fmt.Println(":case list|delete <n>    - List or delete the test cases of the current snippet.")
+	fmt.Println(":judge                   - Run the snippet against all its test cases and report the results.")
+	fmt.Println(":cover [args...]         - Run the buffer and show how many times each line was executed.")
+	fmt.Println(":profile <kind> [args..] - Profile the buffer (cpu, mem, block or mutex) and report the hot spots.")
+	fmt.Println(":asm <func>              - Show the assembly generated for a function, interleaved with the buffer lines.")
+	fmt.Println(":ssa <func>              - Dump the SSA passes of a function to an HTML file in ~/.goblin/ssa.")
+	fmt.Println(":opt [-v]                - Show escape analysis, inlining and bounds check reports for each line.")
+	fmt.Println(":size [-n <top>]         - Show the binary size with the largest symbols and packages.")
+	fmt.Println(":deps                    - List the packages imported by the buffer, directly or not.")
+	fmt.Println(":trace [args...]         - Run the buffer with the execution tracer and summarize goroutines and GC.")
+	fmt.Println(":stress [-n N] [-p P]    - Run the snippet many times in parallel (-race, -t timeout) and group outcomes.")
+	fmt.Println(":debug [args...]         - Debug the buffer with Delve (dlv), stopping at the start of main. ':debug stop' ends it.")
+	fmt.Println(":break [<line>...]       - Set breakpoints on buffer lines, or list them.")
+	fmt.Println(":next, :step, :continue  - Step over, step into or continue in the debugging session.")
+	fmt.Println(":locals, :print <expr>   - Show the local variables or evaluate an expression in the debugging session.")
+	fmt.Println(":check [on|off|strict]   - Check the whole buffer, or set how new lines are checked (strict rejects them).")
+	fmt.Println(":keep [<var>...]         - Save these variables at the next :run and restore them in later runs.")
+	fmt.Println(":forget [<var>...]       - Drop the saved values of some or all kept variables and stop keeping them.")
+	fmt.Println(":watch [<var>...]        - Print each assignment to these variables in main during :run.")
+	fmt.Println(":unwatch [<var>...]      - Stop watching some or all variables.")
+	fmt.Println(":trace-vars [args...]    - Execute the buffer, printing each assignment to any variable in main.")
 	fmt.Println(":help                    - Display this help message.")
 	fmt.Println(":q(uit), :exit, :bye     - Exit the REPL.")
 	fmt.Println()
@@ -839,13 +1235,19 @@ func main() {
 	fmt.Println()
 
 	var codeLines []string
+	var entry []string            // Lines of an entry whose braces, parentheses or raw strings are still open
 	var nextInputReplacesLine = 0 // 0 means append, > 0 means replace line number
+	var pastedLine string         // Line pasted without a line break, given back to be edited
+	var before bufferState        // Buffer before the last input, whose change is recorded in the history
+	var change string             // How the change made by the last input is listed in the history
 	currentSnippetName = ""
 	bufferDirty = false
 
 	rlConfig := &readline.Config{
 		Prompt:      "go> ",
 		HistoryFile: HISTORY_FILE,
+		Stdin:       readline.NewCancelableStdin(stdinPaste),
+		Painter:     codePainter{&entry},
 	}
 	rl, err := readline.NewEx(rlConfig)
 	if err != nil {
@@ -855,31 +1257,116 @@ func main() {
 	updatePrompt(rl)
 
 	for {
-		// Set prompt based on mode (insert vs. normal)
+		// Each input changing the buffer is a change which can be undone
+		if change != "" {
+			if !entriesSet && !slices.Equal(before.lines, codeLines) {
+				// The lines changed by commands stay in their entries
+				bufferEntries = updateEntries(bufferEntries, before.lines, codeLines)
+			}
+			bufferChanges.record(change, before, currentBufferState(codeLines))
+			change, entriesSet = "", false
+		}
+
+		// Set prompt based on mode (insert vs. entry continued vs. normal)
+		prefill := ""
 		if nextInputReplacesLine > 0 {
 			rl.SetPrompt(fmt.Sprintf("%4d> ", nextInputReplacesLine))
+			prefill = codeLines[nextInputReplacesLine-1]
+		} else if len(entry) > 0 {
+			state := scanEntry(entry)
+			rl.SetPrompt(state.prompt())
+			prefill = state.indent()
+		}
+		if pastedLine != "" {
+			prefill, pastedLine = pastedLine, ""
 		}
 
 		// Read line input
-		input, err := rl.Readline()
+		bracketedPaste(true)
+		input, err := rl.ReadlineWithDefault(prefill)
+		bracketedPaste(false)
+		pasted, isPaste := stdinPaste.take()
+		if len(entry) > 0 && !isPaste {
+			input = scanEntry(entry).dedent(input)
+		}
+		if err == readline.ErrInterrupt && len(entry) > 0 {
+			fmt.Println(infoColor("Entry of %d lines cancelled.", len(entry)))
+			entry = nil
+			updatePrompt(rl)
+			continue
+		}
 		if err != nil { // io.EOF, readline.ErrInterrupt
 			if !promptToSave(rl, strings.Join(codeLines, "\n")) {
 				updatePrompt(rl)
 				continue
 			}
+			stopDebugSession()
 			fmt.Println(infoColor("\nExiting Goblin REPL."))
 			rl.Close()
 			break
 		}
 
+		before, change = currentBufferState(codeLines), describeInput(input, entry)
+		if nextInputReplacesLine > 0 || (strings.HasPrefix(strings.TrimSpace(input), ":") && !(len(entry) > 0 && scanEntry(entry).inLiteral())) {
+			// Commands and replaced lines change the buffer outside of the entries checked
+			resetLiveCheck()
+		}
+		if isPaste && strings.Contains(strings.TrimSuffix(input+pasted, "\n"), "\n") {
+			change = fmt.Sprintf("paste of %d lines", strings.Count(strings.TrimSuffix(input+pasted, "\n"), "\n")+1)
+		}
+
+		// A paste of several lines is a single entry, a single line is handled as if typed
+		if isPaste {
+			text := strings.TrimSuffix(input+pasted, "\n")
+			if !strings.Contains(text, "\n") {
+				if !strings.HasSuffix(pasted, "\n") {
+					pastedLine = text
+					continue
+				}
+				input = text
+			} else if nextInputReplacesLine > 0 {
+				lines := strings.Split(text, "\n")
+				n := nextInputReplacesLine
+				codeLines = append(codeLines[:n-1], append(lines, codeLines[n:]...)...)
+				bufferDirty = true
+				fmt.Printf("Line %d replaced by %d lines.\n", n, len(lines))
+				nextInputReplacesLine = 0
+				updatePrompt(rl)
+				continue
+			} else {
+				codeLines, entry = addPaste(rl, codeLines, entry, text)
+				if len(codeLines) == 0 && len(entry) == 0 {
+					updatePrompt(rl)
+				} else {
+					rl.SetPrompt(" -> ")
+				}
+				continue
+			}
+		}
+
 		// If in replace mode and user enters empty line, consider it "done"
 		if nextInputReplacesLine > 0 && strings.TrimSpace(input) == "" {
-			fmt.Printf("Line %d remains empty.\n", nextInputReplacesLine)
+			if codeLines[nextInputReplacesLine-1] != "" {
+				codeLines[nextInputReplacesLine-1] = ""
+				bufferDirty = true
+				fmt.Printf("Line %d emptied.\n", nextInputReplacesLine)
+			} else {
+				fmt.Printf("Line %d remains empty.\n", nextInputReplacesLine)
+			}
 			nextInputReplacesLine = 0
 			updatePrompt(rl)
 			continue
 		}
 
+		// Inside a raw string or a comment, lines are taken as they are, even commands
+		if nextInputReplacesLine == 0 && len(entry) > 0 && scanEntry(entry).inLiteral() {
+			codeLines, entry = addEntryLine(rl, codeLines, entry, input)
+			if len(entry) == 0 {
+				rl.SetPrompt(" -> ")
+			}
+			continue
+		}
+
 		line := strings.TrimSpace(input)
 		fields := strings.Fields(line) // Split input into command and arguments
 
@@ -902,6 +1389,9 @@ func main() {
 
 		cmd := fields[0]
 		args := fields[1:]
+		if substituteRegex.MatchString(line) {
+			cmd = ":s" // Such as :3-7s/old/new/g, where the range and the pattern are not separated
+		}
 
 		// --- Handle REPL Commands ---
 		switch cmd {
@@ -910,6 +1400,7 @@ func main() {
 				updatePrompt(rl)
 				continue
 			}
+			stopDebugSession()
 			fmt.Println(infoColor("\n🐗 Goblin %s - https://github.com/jplozf/goblin", version.String()))
 			rl.Close()
 			return
@@ -919,6 +1410,7 @@ func main() {
 				continue
 			}
 			codeLines = []string{}
+			entry = nil
 			currentSnippetName = ""
 			lastLoadedFilePath = ""   // Reset the last loaded file path
 			nextInputReplacesLine = 0 // Reset insert mode
@@ -927,31 +1419,7 @@ func main() {
 			updatePrompt(rl)
 			continue
 		case ":show":
-			if len(codeLines) == 0 {
-				fmt.Println(infoColor("Code buffer is empty."))
-			} else {
-				fd := int(os.Stdout.Fd())
-				width, _, err := term.GetSize(fd)
-				if err != nil {
-					// Fallback to a default width if getting terminal size fails
-					width = 80
-				}
-
-				title := " Current Code Buffer "
-				padding := (width - len(title)) / 2
-				if padding < 0 {
-					padding = 0
-				}
-
-				header := strings.Repeat("-", padding) + title + strings.Repeat("-", width-padding-len(title))
-				footer := strings.Repeat("-", width)
-
-				fmt.Println(infoColor(header))
-				for i, line := range codeLines {
-					fmt.Printf("%4d: %s\n", i+1, line)
-				}
-				fmt.Println(infoColor(footer))
-			}
+			handleShow(codeLines, args)
 			// Do not reset prompt if in insert mode
 			if nextInputReplacesLine == 0 {
 				updatePrompt(rl)
@@ -1027,56 +1495,85 @@ func main() {
 			bufferDirty = false
 			updatePrompt(rl)
 			continue
-		case ":delete", ":d":
+		case ":delete", ":d", ":m", ":c", ":j":
+			// Cancel insert mode if it's affected
+			if nextInputReplacesLine > 0 {
+				fmt.Println(infoColor("Insert mode cancelled."))
+				nextInputReplacesLine = 0
+			}
+			switch cmd {
+			case ":m", ":c":
+				codeLines = handleMoveLines(codeLines, args, cmd == ":c")
+			case ":j":
+				codeLines = handleJoinLines(codeLines, args)
+			default:
+				codeLines = handleDeleteLines(codeLines, args)
+			}
+			updatePrompt(rl)
+			continue
+		case ":a":
+			if nextInputReplacesLine > 0 {
+				fmt.Println(infoColor("Insert mode cancelled."))
+				nextInputReplacesLine = 0
+			}
+			codeLines = handleAppendLines(rl, codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":e":
 			if len(args) != 1 {
-				fmt.Println(infoColor("Usage: :delete <line_number>"))
+				fmt.Println(infoColor("Usage: :e <line_number>"))
 				continue
 			}
-			lineNum, err := strconv.Atoi(args[0])
-			if err != nil || lineNum < 1 || lineNum > len(codeLines) {
-				fmt.Fprintln(os.Stderr, errorColor("Invalid line number: %s. Please provide a number between 1 and %d.", args[0], len(codeLines)))
+			lineNum, err := parseLineNumber(args[0], 1, len(codeLines))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, errorColor("%v", err))
 				continue
 			}
-
-			// Cancel insert mode if it's affected
+			fmt.Println(infoColor("Edit line %d at the prompt.", lineNum))
+			nextInputReplacesLine = lineNum // Set state for next input
+			continue
+		case ":find":
+			handleFind(codeLines, strings.TrimSpace(strings.TrimPrefix(line, cmd)))
+			if nextInputReplacesLine == 0 {
+				updatePrompt(rl)
+			}
+			continue
+		case ":s":
+			codeLines = handleSubstitute(rl, codeLines, line)
+			updatePrompt(rl)
+			continue
+		case ":source":
+			handleSource(codeLines, args)
+			if nextInputReplacesLine == 0 {
+				updatePrompt(rl)
+			}
+			continue
+		case ":explain":
+			handleExplain(codeLines)
+			if nextInputReplacesLine == 0 {
+				updatePrompt(rl)
+			}
+			continue
+		case ":outline":
+			handleOutline(codeLines)
+			if nextInputReplacesLine == 0 {
+				updatePrompt(rl)
+			}
+			continue
+		case ":goto":
 			if nextInputReplacesLine > 0 {
 				fmt.Println(infoColor("Insert mode cancelled."))
 				nextInputReplacesLine = 0
 			}
-
-			// Adjust for 0-based indexing
-			indexToDelete := lineNum - 1
-			codeLines = append(codeLines[:indexToDelete], codeLines[indexToDelete+1:]...)
-			bufferDirty = true
-			fmt.Println(successColor("Line %d deleted. Current buffer:", lineNum))
-			// Re-display the buffer with line numbers
-			if len(codeLines) == 0 {
-				fmt.Println(infoColor("Code buffer is empty."))
-			} else {
-				fd := int(os.Stdout.Fd())
-				width, _, err := term.GetSize(fd)
-				if err != nil {
-					// Fallback to a default width if getting terminal size fails
-					width = 80
-				}
-
-				title := " Current Code Buffer "
-				padding := (width - len(title)) / 2
-				if padding < 0 {
-					padding = 0
-				}
-
-				header := strings.Repeat("-", padding) + title + strings.Repeat("-", width-padding-len(title))
-				footer := strings.Repeat("-", width)
-
-				fmt.Println(infoColor(header))
-				for i, line := range codeLines {
-					fmt.Printf("%4d: %s\n", i+1, line)
-				}
-				fmt.Println(infoColor(footer))
-			}
+			codeLines = handleGoto(codeLines, args)
 			updatePrompt(rl)
 			continue
+		case ":output":
+			handleOutput(args)
+			if nextInputReplacesLine == 0 {
+				updatePrompt(rl)
+			}
+			continue
 		case ":help":
 			handleHelp()
 			if nextInputReplacesLine == 0 {
@@ -1084,13 +1581,29 @@ func main() {
 			}
 			continue
 		case ":undo", ":u":
-			if len(codeLines) > 0 {
-				codeLines = codeLines[:len(codeLines)-1]
-				bufferDirty = true
-				fmt.Println(successColor("Last entry removed."))
-			} else {
-				fmt.Println(infoColor("Buffer is empty, nothing to undo."))
+			codeLines, change = handleUndo(codeLines), ""
+			if nextInputReplacesLine > 0 {
+				fmt.Println(infoColor("Insert mode cancelled."))
+				nextInputReplacesLine = 0
+			}
+			updatePrompt(rl)
+			continue
+		case ":redo":
+			codeLines, change = handleRedo(codeLines), ""
+			if nextInputReplacesLine > 0 {
+				fmt.Println(infoColor("Insert mode cancelled."))
+				nextInputReplacesLine = 0
 			}
+			updatePrompt(rl)
+			continue
+		case ":entries":
+			handleEntries(codeLines)
+			if nextInputReplacesLine == 0 {
+				updatePrompt(rl)
+			}
+			continue
+		case ":history":
+			handleHistory(args)
 			if nextInputReplacesLine == 0 {
 				updatePrompt(rl)
 			}
@@ -1108,35 +1621,10 @@ func main() {
 			codeLines = tidiedLines
 			bufferDirty = true
 			fmt.Println(successColor("Code buffer tidied."))
-			// Re-display the buffer with line numbers
-			if len(codeLines) == 0 {
-				fmt.Println(infoColor("Code buffer is empty."))
-			} else {
-				fd := int(os.Stdout.Fd())
-				width, _, err := term.GetSize(fd)
-				if err != nil {
-					// Fallback to a default width if getting terminal size fails
-					width = 80
-				}
-
-				title := " Current Code Buffer "
-				padding := (width - len(title)) / 2
-				if padding < 0 {
-					padding = 0
-				}
-
-				header := strings.Repeat("-", padding) + title + strings.Repeat("-", width-padding-len(title))
-				footer := strings.Repeat("-", width)
-
-				fmt.Println(infoColor(header))
-				for i, line := range codeLines {
-					fmt.Printf("%4d: %s\n", i+1, line)
-				}
-				fmt.Println(infoColor(footer))
-			}
+			printCodeBuffer(codeLines)
 			updatePrompt(rl)
 			continue
-		case ":run":
+		case ":run", ":trace-vars":
 			if nextInputReplacesLine > 0 {
 				fmt.Println("Cannot run while in insert mode. Finish editing the line first.")
 				continue
@@ -1147,34 +1635,162 @@ func main() {
 				continue
 			}
 
-			output, execErr := executeCode(strings.Join(codeLines, "\n"), args)
-
-			fd := int(os.Stdout.Fd())
-			width, _, err := term.GetSize(fd)
+			opts, args, err := parseRunFlags(args)
 			if err != nil {
-				// Fallback to a default width if getting terminal size fails
-				width = 80
-			}
-
-			title := " Output "
-			padding := (width - len(title)) / 2
-			if padding < 0 {
-				padding = 0
+				fmt.Fprintln(os.Stderr, errorColor("Error: %v. Usage: :run [--stats] [--annotate] [--deterministic] [--seed=N] [--fixed-clock] [--] [args...]", err))
+				continue
 			}
 
-			header := strings.Repeat("-", padding) + title + strings.Repeat("-", width-padding-len(title))
-			footer := strings.Repeat("-", width)
+			opts.watch = watchedVars
+			opts.traceVars = cmd == ":trace-vars"
+			opts.keep = keptVars
 
-			fmt.Println(infoColor(header))
-			fmt.Print(outputColor(output))
-			fmt.Println(infoColor(footer))
+			result, execErr := executeCode(strings.Join(codeLines, "\n"), args, opts)
+			for _, note := range result.notes {
+				fmt.Println(infoColor("%s", note))
+			}
+			if opts.annotate {
+				printAnnotatedOutput(result.output, result.segments, codeLines)
+			} else {
+				printOutput(result.output)
+			}
 
 			if execErr != nil {
 				fmt.Fprintln(os.Stderr, errorColor("Code Execution Finished with Error Status."))
 			} else {
 				fmt.Println(successColor("Code Execution Successful."))
 			}
+			if opts.stats {
+				printRunStats(result.stats, codeLines)
+			}
+			if opts.deterministic {
+				printDeterministicNote(opts)
+			}
 
+			updatePrompt(rl)
+			continue
+		case ":case":
+			handleCase(rl, args)
+			updatePrompt(rl)
+			continue
+		case ":judge":
+			if len(codeLines) == 0 {
+				fmt.Println("No code to run. Add statements first.")
+				continue
+			}
+			handleJudge(strings.Join(codeLines, "\n"))
+			updatePrompt(rl)
+			continue
+		case ":cover":
+			if len(codeLines) == 0 {
+				fmt.Println("No code to run. Add statements first.")
+				continue
+			}
+			handleCover(codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":profile":
+			if len(codeLines) == 0 {
+				fmt.Println("No code to run. Add statements first.")
+				continue
+			}
+			handleProfile(codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":asm":
+			if len(codeLines) == 0 {
+				fmt.Println(infoColor("No code in buffer to compile."))
+				continue
+			}
+			handleAsm(codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":ssa":
+			if len(codeLines) == 0 {
+				fmt.Println(infoColor("No code in buffer to compile."))
+				continue
+			}
+			handleSsa(strings.Join(codeLines, "\n"), args)
+			updatePrompt(rl)
+			continue
+		case ":opt":
+			if len(codeLines) == 0 {
+				fmt.Println(infoColor("No code in buffer to compile."))
+				continue
+			}
+			handleOpt(codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":size":
+			if len(codeLines) == 0 {
+				fmt.Println(infoColor("No code in buffer to compile."))
+				continue
+			}
+			handleSize(strings.Join(codeLines, "\n"), args)
+			updatePrompt(rl)
+			continue
+		case ":deps":
+			if len(codeLines) == 0 {
+				fmt.Println(infoColor("No code in buffer to compile."))
+				continue
+			}
+			handleDeps(strings.Join(codeLines, "\n"))
+			updatePrompt(rl)
+			continue
+		case ":trace":
+			if len(codeLines) == 0 {
+				fmt.Println("No code to run. Add statements first.")
+				continue
+			}
+			handleTrace(codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":stress":
+			if len(codeLines) == 0 {
+				fmt.Println("No code to run. Add statements first.")
+				continue
+			}
+			handleStress(strings.Join(codeLines, "\n"), args)
+			updatePrompt(rl)
+			continue
+		case ":debug":
+			handleDebug(codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":break":
+			handleBreak(args, codeLines)
+			updatePrompt(rl)
+			continue
+		case ":next", ":step", ":continue":
+			debugCommand(strings.TrimPrefix(cmd, ":"))
+			updatePrompt(rl)
+			continue
+		case ":locals":
+			handleLocals()
+			updatePrompt(rl)
+			continue
+		case ":print":
+			handlePrint(strings.TrimSpace(strings.TrimPrefix(line, cmd)))
+			updatePrompt(rl)
+			continue
+		case ":check":
+			handleCheck(codeLines, args)
+			updatePrompt(rl)
+			continue
+		case ":keep":
+			handleKeep(args)
+			updatePrompt(rl)
+			continue
+		case ":forget":
+			handleForget(args)
+			updatePrompt(rl)
+			continue
+		case ":watch":
+			handleWatch(args)
+			updatePrompt(rl)
+			continue
+		case ":unwatch":
+			handleUnwatch(args)
 			updatePrompt(rl)
 			continue
 		case ":sys":
@@ -1197,8 +1813,11 @@ func main() {
 			continue
 		default:
 			// --- Accumulate Code ---
-			codeLines = append(codeLines, input) // Use raw input to preserve indentation
-			bufferDirty = true
+			codeLines, entry = addEntryLine(rl, codeLines, entry, input) // Use raw input to preserve indentation
+			if len(codeLines) == 0 {
+				updatePrompt(rl)
+				continue
+			}
 			rl.SetPrompt(" -> ") // Change prompt for multi-line/subsequent input
 		}
 	}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRunFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		want     runOptions
+		wantArgs []string
+		wantErr  bool
+	}{
+		{"no args", nil, runOptions{seed: defaultDeterministicSeed}, nil, false},
+		{"program args", []string{"a", "--stats"}, runOptions{seed: defaultDeterministicSeed}, []string{"a", "--stats"}, false},
+		{"flags", []string{"--stats", "--annotate", "a"}, runOptions{stats: true, annotate: true, seed: defaultDeterministicSeed}, []string{"a"}, false},
+		{"seed", []string{"--seed=7"}, runOptions{deterministic: true, seed: 7}, nil, false},
+		{"fixed clock", []string{"--fixed-clock"}, runOptions{deterministic: true, fixedClock: true, seed: defaultDeterministicSeed}, nil, false},
+		{"unknown flag passed through", []string{"--stats", "--verbose", "x"}, runOptions{stats: true, seed: defaultDeterministicSeed}, []string{"--verbose", "x"}, false},
+		{"double dash", []string{"--", "--stats"}, runOptions{seed: defaultDeterministicSeed}, []string{"--stats"}, false},
+		{"invalid seed", []string{"--seed=x"}, runOptions{}, nil, true},
+		{"seed without value", []string{"--seed"}, runOptions{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, args, err := parseRunFlags(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRunFlags() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if opts.stats != tt.want.stats || opts.annotate != tt.want.annotate || opts.deterministic != tt.want.deterministic ||
+				opts.fixedClock != tt.want.fixedClock || opts.seed != tt.want.seed {
+				t.Errorf("parseRunFlags() options = %+v, want %+v", opts, tt.want)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("parseRunFlags() args = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
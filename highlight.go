@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Classes of the tokens highlighted, which are the keys of GOBLIN_COLORS.
+const (
+	hlKeyword = "keyword"
+	hlType    = "type"    // Predeclared types
+	hlBuiltin = "builtin" // Predeclared functions and constants
+	hlString  = "string"
+	hlNumber  = "number"
+	hlComment = "comment"
+)
+
+// highlightColors are the colors of the token classes. They can be set with the
+// GOBLIN_COLORS environment variable, a list of class=SGR pairs separated by colons,
+// such as GOBLIN_COLORS="keyword=1;34:comment=90".
+var highlightColors = map[string]*color.Color{
+	hlKeyword: color.New(color.FgMagenta),
+	hlType:    color.New(color.FgBlue),
+	hlBuiltin: color.New(color.FgBlue),
+	hlString:  color.New(color.FgGreen),
+	hlNumber:  color.New(color.FgCyan),
+	hlComment: color.New(color.FgHiBlack),
+}
+
+// predeclaredTypes and predeclaredFuncs are the identifiers of the universe scope.
+var (
+	predeclaredTypes = map[string]bool{
+		"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true,
+		"complex128": true, "error": true, "float32": true, "float64": true, "int": true,
+		"int8": true, "int16": true, "int32": true, "int64": true, "rune": true,
+		"string": true, "uint": true, "uint8": true, "uint16": true, "uint32": true,
+		"uint64": true, "uintptr": true,
+	}
+	predeclaredFuncs = map[string]bool{
+		"append": true, "cap": true, "clear": true, "close": true, "complex": true,
+		"copy": true, "delete": true, "imag": true, "len": true, "make": true, "max": true,
+		"min": true, "new": true, "panic": true, "print": true, "println": true,
+		"real": true, "recover": true, "true": true, "false": true, "iota": true, "nil": true,
+	}
+)
+
+func init() {
+	for _, pair := range strings.Split(os.Getenv("GOBLIN_COLORS"), ":") {
+		class, sgr, ok := strings.Cut(pair, "=")
+		if _, known := highlightColors[class]; !ok || !known {
+			continue
+		}
+		var attrs []color.Attribute
+		for _, code := range strings.Split(sgr, ";") {
+			if n, err := strconv.Atoi(code); err == nil {
+				attrs = append(attrs, color.Attribute(n))
+			}
+		}
+		highlightColors[class] = color.New(attrs...)
+	}
+}
+
+// tokenClass returns the class of a token, or "" when it is not highlighted.
+func tokenClass(tok token.Token, lit string) string {
+	switch {
+	case tok.IsKeyword():
+		return hlKeyword
+	case tok == token.STRING || tok == token.CHAR:
+		return hlString
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		return hlNumber
+	case tok == token.COMMENT:
+		return hlComment
+	case tok == token.IDENT && predeclaredTypes[lit]:
+		return hlType
+	case tok == token.IDENT && predeclaredFuncs[lit]:
+		return hlBuiltin
+	}
+	return ""
+}
+
+// highlightCode returns Go source lines with their tokens colored, unless colors are
+// disabled, when the output is not a terminal or NO_COLOR is set. The lines are scanned as
+// a whole, so that raw strings and comments spanning several lines are colored.
+func highlightCode(lines []string) []string {
+	if color.NoColor {
+		return lines
+	}
+	src := strings.Join(lines, "\n")
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", -1, len(src)), []byte(src), func(token.Position, string) {}, scanner.ScanComments)
+
+	var b strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		class := tokenClass(tok, lit)
+		if class == "" {
+			continue
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		start := fset.Position(pos).Offset
+		end := min(start+len(lit), len(src))
+		b.WriteString(src[last:start])
+		// Colored line by line, so that each line can be printed on its own
+		for i, part := range strings.Split(src[start:end], "\n") {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(highlightColors[class].Sprint(part))
+		}
+		last = end
+	}
+	b.WriteString(src[last:])
+	return strings.Split(b.String(), "\n")
+}
+
+// codePainter highlights the line being typed, after the lines of the entry it continues.
+type codePainter struct {
+	entry *[]string
+}
+
+// Paint implements readline.Painter.
+func (p codePainter) Paint(line []rune, _ int) []rune {
+	lines := append(append([]string(nil), *p.entry...), string(line))
+	return []rune(highlightCode(lines)[len(lines)-1])
+}
+
+// formatHighlighted returns Go source lines from first to last with line numbers,
+// highlighted. The lines before them are scanned too, for raw strings and comments.
+func formatHighlighted(lines []string, first, last int) string {
+	var b strings.Builder
+	highlighted := highlightCode(lines[:last])
+	for n := first; n <= last; n++ {
+		fmt.Fprintf(&b, "%4d: %s\n", n, highlighted[n-1])
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+var ansiRegex = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestHighlightCode(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = false
+
+	colored := func(class, text string) string { return highlightColors[class].Sprint(text) }
+	if colored(hlKeyword, "for") == "for" {
+		t.Fatal("colors are disabled")
+	}
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string // Colored texts expected, line by line
+	}{
+		{"keyword", []string{"for {"}, []string{colored(hlKeyword, "for")}},
+		{"string and number", []string{`s, n := "a", 42`}, []string{colored(hlString, `"a"`) + ", " + colored(hlNumber, "42")}},
+		{"predeclared", []string{"x := len([]int{})"}, []string{colored(hlBuiltin, "len") + "([]" + colored(hlType, "int") + "{})"}},
+		{"comment", []string{"x := 1 // one"}, []string{colored(hlComment, "// one")}},
+		{"raw string on several lines", []string{"s := `a", "b`"}, []string{colored(hlString, "`a"), colored(hlString, "b`")}},
+		{"comment on several lines", []string{"/* a", "b */ x"}, []string{colored(hlComment, "/* a"), colored(hlComment, "b */") + " x"}},
+		{"identifiers", []string{"x = y"}, []string{"x = y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := highlightCode(tt.lines)
+			if len(got) != len(tt.lines) {
+				t.Fatalf("highlightCode() = %d lines, want %d", len(got), len(tt.lines))
+			}
+			for i := range got {
+				if plain := ansiRegex.ReplaceAllString(got[i], ""); plain != tt.lines[i] {
+					t.Errorf("line %d without colors = %q, want %q", i+1, plain, tt.lines[i])
+				}
+				if !strings.Contains(got[i], tt.want[i]) {
+					t.Errorf("line %d = %q, want it to contain %q", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHighlightCodeNoColor(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+
+	lines := []string{"for i := 0; i < 3; i++ {", `	println("x")`, "}"}
+	if got := highlightCode(lines); !slices.Equal(got, lines) {
+		t.Errorf("highlightCode() = %q, want %q", got, lines)
+	}
+	want := "   2: \tprintln(\"x\")\n   3: }\n"
+	if got := formatHighlighted(lines, 2, 3); got != want {
+		t.Errorf("formatHighlighted() = %q, want %q", got, want)
+	}
+}
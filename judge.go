@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// defaultCaseTimeLimit is the time limit applied to a test case when none is given.
+const defaultCaseTimeLimit = 2 * time.Second
+
+// testCase is a stdin input together with the output the snippet is expected to print.
+type testCase struct {
+	Input     string `json:"input"`
+	Expected  string `json:"expected"`
+	TimeLimit string `json:"time_limit,omitempty"`
+}
+
+// limit returns the time limit of the test case, falling back to defaultCaseTimeLimit.
+func (tc testCase) limit() time.Duration {
+	if d, err := time.ParseDuration(tc.TimeLimit); err == nil && d > 0 {
+		return d
+	}
+	return defaultCaseTimeLimit
+}
+
+// casesFilePath returns the path of the file holding the test cases of the current snippet.
+// Cases are stored next to the snippet file, so the snippet must have a name.
+func casesFilePath() (string, error) {
+	if currentSnippetName == "" {
+		return "", fmt.Errorf("the current snippet has no name yet, use :save <file> first")
+	}
+	dir := REPL_SAVES_DIR
+	if lastLoadedFilePath != "" {
+		dir = filepath.Dir(lastLoadedFilePath)
+	}
+	return filepath.Join(dir, currentSnippetName+".cases.json"), nil
+}
+
+// loadCases reads the test cases of the current snippet. A missing file means no cases.
+func loadCases() ([]testCase, error) {
+	path, err := casesFilePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var cases []testCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("invalid cases file '%s': %w", path, err)
+	}
+	return cases, nil
+}
+
+// saveCases writes the test cases of the current snippet, removing the file when there are none left.
+func saveCases(cases []testCase) error {
+	path, err := casesFilePath()
+	if err != nil {
+		return err
+	}
+	if len(cases) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(cases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// readBlock reads lines from the user until a line containing only "." is entered.
+// It returns false if the input was interrupted.
+func readBlock(rl *readline.Instance, prompt string) (string, bool) {
+	rl.HistoryDisable()
+	defer rl.HistoryEnable()
+
+	var lines []string
+	rl.SetPrompt(prompt)
+	for {
+		line, err := rl.Readline()
+		if err != nil {
+			return "", false
+		}
+		if line == "." {
+			break
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", true
+	}
+	return strings.Join(lines, "\n") + "\n", true
+}
+
+// handleCase manages the test cases of the current snippet.
+func handleCase(rl *readline.Instance, args []string) {
+	usage := "Usage: :case add [time_limit] | :case list | :case delete <number> | :case clear"
+	if len(args) == 0 {
+		fmt.Println(infoColor(usage))
+		return
+	}
+
+	cases, err := loadCases()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error loading test cases: %v", err))
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		tc := testCase{}
+		if len(args) > 1 {
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, errorColor("Invalid time limit: %s. Use a duration such as 500ms or 2s.", args[1]))
+				return
+			}
+			tc.TimeLimit = d.String()
+		}
+		fmt.Println(infoColor("Enter the input, finish with a line containing only '.'"))
+		input, ok := readBlock(rl, "in> ")
+		if !ok {
+			fmt.Println(errorColor("\nOperation cancelled."))
+			return
+		}
+		fmt.Println(infoColor("Enter the expected output, finish with a line containing only '.'"))
+		expected, ok := readBlock(rl, "out> ")
+		if !ok {
+			fmt.Println(errorColor("\nOperation cancelled."))
+			return
+		}
+		tc.Input = input
+		tc.Expected = expected
+		cases = append(cases, tc)
+		if err := saveCases(cases); err != nil {
+			fmt.Fprintln(os.Stderr, errorColor("Error saving test cases: %v", err))
+			return
+		}
+		fmt.Println(successColor("Test case %d added.", len(cases)))
+	case "list", "ls":
+		if len(cases) == 0 {
+			fmt.Println(infoColor("No test cases for this snippet. Use :case add to record one."))
+			return
+		}
+		var lines []string
+		for i, tc := range cases {
+			lines = append(lines, infoColor("Case %d (limit %s)", i+1, tc.limit()))
+			lines = append(lines, "  input:    "+strings.ReplaceAll(strings.TrimRight(tc.Input, "\n"), "\n", "\n            "))
+			lines = append(lines, "  expected: "+strings.ReplaceAll(strings.TrimRight(tc.Expected, "\n"), "\n", "\n            "))
+		}
+		printBoxed("Test Cases", lines)
+	case "delete", "d":
+		if len(args) != 2 {
+			fmt.Println(infoColor(usage))
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > len(cases) {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid case number: %s. Please provide a number between 1 and %d.", args[1], len(cases)))
+			return
+		}
+		cases = append(cases[:n-1], cases[n:]...)
+		if err := saveCases(cases); err != nil {
+			fmt.Fprintln(os.Stderr, errorColor("Error saving test cases: %v", err))
+			return
+		}
+		fmt.Println(successColor("Test case %d deleted.", n))
+	case "clear":
+		if err := saveCases(nil); err != nil {
+			fmt.Fprintln(os.Stderr, errorColor("Error saving test cases: %v", err))
+			return
+		}
+		fmt.Println(successColor("All test cases deleted."))
+	default:
+		fmt.Println(infoColor(usage))
+	}
+}
+
+// normalizeOutput removes trailing spaces on each line and trailing empty lines,
+// so that outputs are compared the way online judges usually do.
+func normalizeOutput(s string) []string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a line based diff between want and got, using the longest
+// common subsequence. Lines only in want are prefixed with "-", lines only in got with "+".
+func diffLines(want, got []string) []string {
+	n, m := len(want), len(got)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case want[i] == got[j]:
+			diff = append(diff, "  "+want[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, errorColor("- %s", want[i]))
+			i++
+		default:
+			diff = append(diff, successColor("+ %s", got[j]))
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		diff = append(diff, errorColor("- %s", want[i]))
+	}
+	for ; j < m; j++ {
+		diff = append(diff, successColor("+ %s", got[j]))
+	}
+	return diff
+}
+
+// caseResult holds the outcome of running the snippet against one test case.
+type caseResult struct {
+	status  string
+	elapsed time.Duration
+	output  string
+	detail  string
+}
+
+// runCase runs the compiled snippet with the input of tc, enforcing its time limit.
+func runCase(binPath string, tc testCase) caseResult {
+	ctx, cancel := context.WithTimeout(context.Background(), tc.limit())
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binPath)
+	cmd.Stdin = strings.NewReader(tc.Input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start)
+
+	res := caseResult{elapsed: elapsed, output: stdout.String()}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.status = "TLE"
+		res.detail = fmt.Sprintf("time limit of %s exceeded", tc.limit())
+	case err != nil:
+		res.status = "RTE"
+		res.detail = strings.TrimSpace(err.Error() + "\n" + stderr.String())
+	case strings.Join(normalizeOutput(res.output), "\n") == strings.Join(normalizeOutput(tc.Expected), "\n"):
+		res.status = "PASS"
+	default:
+		res.status = "FAIL"
+	}
+	return res
+}
+
+// handleJudge builds the snippet once and runs it against every recorded test case.
+func handleJudge(code string) {
+	cases, err := loadCases()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error loading test cases: %v", err))
+		return
+	}
+	if len(cases) == 0 {
+		fmt.Println(infoColor("No test cases for this snippet. Use :case add to record one."))
+		return
+	}
+
+	tmpDir, binPath, buildOutput, err := buildProgram(generateProgram(code), nil)
+	if err != nil {
+		fmt.Print(outputColor(buildOutput))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	results := make([]caseResult, len(cases))
+	passed := 0
+	var rows []string
+	rows = append(rows, fmt.Sprintf("%6s  %-6s  %12s  %10s", "Case", "Status", "Time", "Limit"))
+	for i, tc := range cases {
+		results[i] = runCase(binPath, tc)
+		status := fmt.Sprintf("%-6s", results[i].status)
+		if results[i].status == "PASS" {
+			passed++
+			status = successColor(status)
+		} else {
+			status = errorColor(status)
+		}
+		rows = append(rows, fmt.Sprintf("%6d  %s  %12s  %10s", i+1, status, results[i].elapsed.Round(time.Microsecond), tc.limit()))
+	}
+	printBoxed("Judge", rows)
+
+	for i, res := range results {
+		switch res.status {
+		case "FAIL":
+			fmt.Println(infoColor("Case %d: wrong output (- expected, + got)", i+1))
+			for _, line := range diffLines(normalizeOutput(cases[i].Expected), normalizeOutput(res.output)) {
+				fmt.Println(line)
+			}
+		case "TLE", "RTE":
+			fmt.Println(infoColor("Case %d: %s", i+1, res.detail))
+		}
+	}
+
+	if passed == len(cases) {
+		fmt.Println(successColor("All %d test cases passed.", len(cases)))
+	} else {
+		fmt.Fprintln(os.Stderr, errorColor("%d of %d test cases passed.", passed, len(cases)))
+	}
+}
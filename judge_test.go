@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestDiffLines(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+
+	tests := []struct {
+		name      string
+		want, got []string
+		diff      []string
+	}{
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, []string{"  a", "  b"}},
+		{"changed line", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []string{"  a", "- b", "+ x", "  c"}},
+		{"missing line", []string{"a", "b", "c"}, []string{"a", "c"}, []string{"  a", "- b", "  c"}},
+		{"extra line", []string{"a"}, []string{"a", "b"}, []string{"  a", "+ b"}},
+		{"nothing expected", nil, []string{"a"}, []string{"+ a"}},
+		{"no output", []string{"a"}, nil, []string{"- a"}},
+		{"both empty", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := diffLines(tt.want, tt.got); !slices.Equal(diff, tt.diff) {
+				t.Errorf("diffLines() = %q, want %q", diff, tt.diff)
+			}
+		})
+	}
+}
+
+func TestNormalizeOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{"trailing spaces", "a  \nb\t\n", []string{"a", "b"}},
+		{"trailing empty lines", "a\n\n\n", []string{"a"}},
+		{"CRLF", "a\r\nb\r\n", []string{"a", "b"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeOutput(tt.output); !slices.Equal(got, tt.want) {
+				t.Errorf("normalizeOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
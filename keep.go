@@ -0,0 +1,676 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// STATE_DIR holds the variables kept between runs, in a directory for each snippet.
+var STATE_DIR = filepath.Join(os.Getenv("HOME"), ".goblin", "state")
+
+// keptVars holds the names of the variables set with :keep. Their value is saved by a
+// run and restored by the next ones, instead of running the statements producing them.
+var keptVars []string
+
+// keepHarness is compiled along with a generated program rewritten by keepSetup.
+const keepHarness = `package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+)
+
+func goblinKeepLoad(name, path string, v interface{}) {
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		err = gob.NewDecoder(f).Decode(v)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goblin: cannot restore %s: %v (use :forget %s)\n", name, err, name)
+		os.Exit(1)
+	}
+}
+
+func goblinKeepSave(name, path string, v interface{}) {
+	f, err := os.Create(path)
+	if err == nil {
+		err = gob.NewEncoder(f).Encode(v)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+		fmt.Fprintf(os.Stderr, "goblin: cannot keep %s: %v\n", name, err)
+	}
+}
+`
+
+// keepMeta describes a saved variable. A saved value is only restored when the code
+// producing it is unchanged.
+type keepMeta struct {
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+}
+
+// keepAnalysis holds the type-checked statements of main, and for each of them the
+// variables of main they define, use and change.
+type keepAnalysis struct {
+	fset      *token.FileSet
+	info      *types.Info
+	program   string
+	lineMap   []int
+	imports   map[string]string // Import path to the name used in the program
+	stmts     []ast.Stmt
+	defs      [][]*types.Var
+	uses      [][]*types.Var
+	writes    [][]*types.Var
+	mainStart int // Offset of main, the code before it is part of the hash of each plan
+}
+
+// keepPlan tells how a kept variable is produced by the statements of main.
+type keepPlan struct {
+	name   string
+	target *types.Var
+	typ    string
+	decl   int          // Statement declaring the variable
+	stmts  map[int]bool // Statements producing the variable, including decl
+	hash   string
+	valid  bool // The saved value can be restored
+	saving bool // The run saves the value
+}
+
+// keepRun is what keepSetup did to a program, so that keepFinish completes it after the run.
+type keepRun struct {
+	dir   string
+	plans []*keepPlan
+	notes []string
+}
+
+// keepStateDir returns the directory holding the kept variables of the current snippet.
+func keepStateDir() string {
+	if currentSnippetName == "" {
+		return filepath.Join(STATE_DIR, "_buffer")
+	}
+	return filepath.Join(STATE_DIR, currentSnippetName)
+}
+
+// analyzeKeep type-checks a generated program and collects the variables of main
+// defined, used and changed by each of its statements.
+func analyzeKeep(program string, lineMap []int) (*keepAnalysis, error) {
+	fset, file, info, typeErrors, err := typeCheckProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	if len(typeErrors) > 0 {
+		return nil, typeErrors[0]
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil {
+		return nil, fmt.Errorf("no main function found")
+	}
+
+	a := &keepAnalysis{
+		fset:      fset,
+		info:      info,
+		program:   program,
+		lineMap:   lineMap,
+		imports:   make(map[string]string),
+		stmts:     mainFunc.Body.List,
+		mainStart: fset.Position(mainFunc.Pos()).Offset,
+	}
+	for _, spec := range file.Imports {
+		obj := info.Implicits[spec]
+		if spec.Name != nil {
+			obj = info.Defs[spec.Name]
+		}
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			a.imports[pkgName.Imported().Path()] = pkgName.Name()
+		}
+	}
+
+	// Variables declared by the statements of main belong to the scope of the function
+	scope := info.Scopes[mainFunc.Type]
+	local := func(obj types.Object) *types.Var {
+		if v, ok := obj.(*types.Var); ok && v.Parent() == scope {
+			return v
+		}
+		return nil
+	}
+	var root func(expr ast.Expr) *types.Var
+	root = func(expr ast.Expr) *types.Var {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return local(info.Uses[e])
+		case *ast.SelectorExpr:
+			return root(e.X)
+		case *ast.IndexExpr:
+			return root(e.X)
+		case *ast.StarExpr:
+			return root(e.X)
+		case *ast.ParenExpr:
+			return root(e.X)
+		}
+		return nil
+	}
+
+	for _, stmt := range a.stmts {
+		var defs, uses, writes []*types.Var
+		addWrite := func(expr ast.Expr) {
+			if v := root(expr); v != nil {
+				writes = append(writes, v)
+			}
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.Ident:
+				if v := local(info.Defs[node]); v != nil {
+					defs = append(defs, v)
+				}
+				if v := local(info.Uses[node]); v != nil {
+					uses = append(uses, v)
+				}
+			case *ast.AssignStmt:
+				for _, lhs := range node.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok && node.Tok == token.DEFINE && info.Defs[ident] != nil {
+						continue
+					}
+					addWrite(lhs)
+				}
+			case *ast.IncDecStmt:
+				addWrite(node.X)
+			case *ast.RangeStmt:
+				if node.Tok == token.ASSIGN {
+					addWrite(node.Key)
+					addWrite(node.Value)
+				}
+			case *ast.UnaryExpr:
+				if node.Op == token.AND {
+					addWrite(node.X)
+				}
+			case *ast.ExprStmt:
+				// A method called for its effect may change its receiver
+				if call, ok := node.X.(*ast.CallExpr); ok {
+					if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+						if s := info.Selections[sel]; s != nil && s.Kind() == types.MethodVal {
+							addWrite(sel.X)
+						}
+					}
+				}
+			}
+			return true
+		})
+		a.defs = append(a.defs, defs)
+		a.uses = append(a.uses, uses)
+		a.writes = append(a.writes, writes)
+	}
+	return a, nil
+}
+
+// containsVar reports whether a variable is in a list.
+func containsVar(vars []*types.Var, v *types.Var) bool {
+	for _, w := range vars {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+// stmtText returns the source of a statement of main.
+func (a *keepAnalysis) stmtText(i int) string {
+	return a.program[a.fset.Position(a.stmts[i].Pos()).Offset:a.fset.Position(a.stmts[i].End()).Offset]
+}
+
+// stmtLines returns the first and last buffer lines of a statement of main.
+func (a *keepAnalysis) stmtLines(i int) (int, int) {
+	return bufferLine(a.lineMap, a.fset.Position(a.stmts[i].Pos()).Line), bufferLine(a.lineMap, a.fset.Position(a.stmts[i].End()).Line)
+}
+
+// plan finds the statements of main producing a variable: its declaration, the
+// statements changing it, and the statements computing values only used by those.
+func (a *keepAnalysis) plan(name string) (*keepPlan, error) {
+	p := &keepPlan{name: name, decl: -1, stmts: make(map[int]bool)}
+	for i, defs := range a.defs {
+		for _, v := range defs {
+			if v.Name() == name && p.decl < 0 {
+				p.decl, p.target = i, v
+			}
+		}
+	}
+	if p.decl < 0 {
+		return nil, fmt.Errorf("it is not declared by a statement of main")
+	}
+
+	// 1. The declaration and the statements changing the variable
+	p.stmts[p.decl] = true
+	for i := p.decl + 1; i < len(a.stmts); i++ {
+		if containsVar(a.writes[i], p.target) {
+			p.stmts[i] = true
+		}
+	}
+
+	// 2. The statements computing values only used by the statements of the plan, along
+	// with the statements checking or releasing these values, such as 'if err != nil'
+	// or 'defer f.Close()', as long as they do not use the variable
+	isCheck := func(i int) bool {
+		switch a.stmts[i].(type) {
+		case *ast.IfStmt, *ast.DeferStmt:
+			return len(a.defs[i]) == 0 && !containsVar(a.uses[i], p.target)
+		}
+		return false
+	}
+	definedBy := func() map[*types.Var]bool {
+		defined := make(map[*types.Var]bool)
+		for i := range p.stmts {
+			for _, v := range a.defs[i] {
+				defined[v] = true
+			}
+		}
+		return defined
+	}
+	for changed := true; changed; {
+		changed = false
+		defined := definedBy()
+		for i := range a.stmts {
+			if p.stmts[i] {
+				continue
+			}
+			if isCheck(i) {
+				for _, v := range a.uses[i] {
+					if defined[v] && v != p.target {
+						p.stmts[i], changed = true, true
+						break
+					}
+				}
+				continue
+			}
+			if len(a.defs[i]) == 0 {
+				continue
+			}
+			usedByPlan, checks := false, []int{}
+			ok := true
+			for j := range a.stmts {
+				if j == i {
+					continue
+				}
+				for _, v := range a.defs[i] {
+					if !containsVar(a.uses[j], v) {
+						continue
+					}
+					if p.stmts[j] {
+						usedByPlan = true
+					} else if isCheck(j) {
+						checks = append(checks, j)
+					} else {
+						ok = false
+					}
+				}
+			}
+			if ok && usedByPlan {
+				p.stmts[i], changed = true, true
+				for _, j := range checks {
+					p.stmts[j] = true
+				}
+			}
+		}
+	}
+
+	// 3. The statements left out must not need anything from the plan but the variable
+	defined := definedBy()
+	for i := range a.stmts {
+		for _, v := range a.uses[i] {
+			if !p.stmts[i] && defined[v] && v != p.target {
+				line, _ := a.stmtLines(i)
+				return nil, fmt.Errorf("%s, computed along with it, is also used at line %d", v.Name(), line)
+			}
+		}
+		for _, v := range a.writes[i] {
+			if p.stmts[i] && !defined[v] {
+				line, _ := a.stmtLines(i)
+				return nil, fmt.Errorf("line %d also changes %s", line, v.Name())
+			}
+		}
+	}
+
+	// 4. The type of the variable must be written with the imports of the program
+	var missing string
+	p.typ = types.TypeString(p.target.Type(), func(pkg *types.Package) string {
+		if pkg.Path() == "main" {
+			return ""
+		}
+		name, ok := a.imports[pkg.Path()]
+		if !ok {
+			missing = pkg.Path()
+			return pkg.Name()
+		}
+		return name
+	})
+	if missing != "" {
+		return nil, fmt.Errorf("its type %s needs package %s, which is not imported", p.typ, missing)
+	}
+
+	// 5. The hash of the code producing the variable tells when the saved value is stale
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", p.typ, a.program[:a.mainStart])
+	for _, i := range p.sortedStmts() {
+		fmt.Fprintf(h, "%s\n", a.stmtText(i))
+	}
+	p.hash = hex.EncodeToString(h.Sum(nil))
+	return p, nil
+}
+
+// sortedStmts returns the statements of a plan in order.
+func (p *keepPlan) sortedStmts() []int {
+	var stmts []int
+	for i := range p.stmts {
+		stmts = append(stmts, i)
+	}
+	sort.Ints(stmts)
+	return stmts
+}
+
+// bufferRanges returns the buffer lines of the statements of a plan, such as "lines 2-4, 7".
+func (a *keepAnalysis) bufferRanges(stmts []int) string {
+	var spans [][2]int
+	for _, i := range stmts {
+		first, last := a.stmtLines(i)
+		if first == 0 {
+			continue
+		}
+		if n := len(spans); n > 0 && spans[n-1][1]+1 >= first {
+			spans[n-1][1] = last
+		} else {
+			spans = append(spans, [2]int{first, last})
+		}
+	}
+	var ranges []string
+	for _, span := range spans {
+		if span[0] == span[1] {
+			ranges = append(ranges, strconv.Itoa(span[0]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", span[0], span[1]))
+		}
+	}
+	if len(ranges) == 1 && len(spans) == 1 && spans[0][0] == spans[0][1] {
+		return "line " + ranges[0]
+	}
+	return "lines " + strings.Join(ranges, ", ")
+}
+
+// readKeepMeta reads the description of a saved variable.
+func readKeepMeta(dir, name string) (*keepMeta, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	meta := &keepMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".gob")); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// keepSetup rewrites a generated program for the kept variables. When all of them
+// have a saved value produced by the same code, the statements producing them are
+// replaced by the restoration of the values. Otherwise the program runs as is and
+// saves the values once they are produced. The line numbers of the program are unchanged.
+func keepSetup(program string, lineMap []int, names []string) (string, string, *keepRun) {
+	run := &keepRun{dir: keepStateDir()}
+	a, err := analyzeKeep(program, lineMap)
+	if err != nil {
+		// The compiler reports the errors of the program
+		return program, "", run
+	}
+
+	for _, name := range names {
+		p, err := a.plan(name)
+		if err != nil {
+			run.notes = append(run.notes, fmt.Sprintf("%s cannot be kept: %v.", name, err))
+			continue
+		}
+		meta, err := readKeepMeta(run.dir, name)
+		p.valid = err == nil && meta.Hash == p.hash
+		run.plans = append(run.plans, p)
+	}
+	if len(run.plans) == 0 {
+		return program, "", run
+	}
+	if err := os.MkdirAll(run.dir, 0755); err != nil {
+		run.notes = append(run.notes, fmt.Sprintf("Cannot create %s: %v.", run.dir, err))
+		run.plans = nil
+		return program, "", run
+	}
+
+	// A saved value is not restored when the statements producing it also produce a
+	// variable computed by this run
+	for changed := true; changed; {
+		changed = false
+		computed := make(map[int]bool)
+		for _, p := range run.plans {
+			for i := range p.stmts {
+				computed[i] = computed[i] || !p.valid
+			}
+		}
+		for _, p := range run.plans {
+			for i := range p.stmts {
+				if p.valid && computed[i] {
+					p.valid, changed = false, true
+				}
+			}
+		}
+	}
+
+	skipped := make(map[int]bool)
+	restored := make(map[int][]*keepPlan)
+	savedAfter := make(map[int][]*keepPlan)
+	for _, p := range run.plans {
+		stmts := p.sortedStmts()
+		if p.valid {
+			for _, i := range stmts {
+				skipped[i] = true
+			}
+			restored[p.decl] = append(restored[p.decl], p)
+			run.notes = append(run.notes, fmt.Sprintf("Restored %s from a previous run instead of running %s.", p.name, a.bufferRanges(stmts)))
+		} else {
+			// The value is saved right after the last statement producing it
+			last := stmts[len(stmts)-1]
+			savedAfter[last] = append(savedAfter[last], p)
+			p.saving = true
+			run.notes = append(run.notes, fmt.Sprintf("Keeping %s, produced by %s, for the next runs.", p.name, a.bufferRanges(stmts)))
+		}
+	}
+	definedBySkipped := make(map[*types.Var]bool)
+	for i := range skipped {
+		for _, v := range a.defs[i] {
+			definedBySkipped[v] = true
+		}
+	}
+	for _, p := range run.plans {
+		delete(definedBySkipped, p.target)
+	}
+
+	var b strings.Builder
+	last := 0
+	usedPackages := make(map[string]string)
+	for i, stmt := range a.stmts {
+		start, end := a.fset.Position(stmt.Pos()).Offset, a.fset.Position(stmt.End()).Offset
+		for _, p := range savedAfter[i] {
+			b.WriteString(program[last:end])
+			b.WriteString(fmt.Sprintf("; goblinKeepSave(%q, %q, &%s)", p.name, filepath.Join(run.dir, p.name+".gob.tmp"), p.name))
+			last = end
+		}
+		if !skipped[i] {
+			continue
+		}
+		var parts []string
+		for _, p := range restored[i] {
+			path := filepath.Join(run.dir, p.name+".gob")
+			parts = append(parts, fmt.Sprintf("var %s %s; goblinKeepLoad(%q, %q, &%s); _ = %s", p.name, p.typ, p.name, path, p.name, p.name))
+		}
+		// Keep using the variables and packages only used by the statements left out
+		seen := make(map[*types.Var]bool)
+		for _, v := range a.uses[i] {
+			if !definedBySkipped[v] && !seen[v] && !containsVar(a.defs[i], v) {
+				seen[v] = true
+				parts = append(parts, "_ = "+v.Name())
+			}
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok {
+					if pkgName, ok := a.info.Uses[ident].(*types.PkgName); ok {
+						if use := packageUse(pkgName.Name(), a.info.Uses[sel.Sel]); use != "" {
+							usedPackages[pkgName.Name()] = use
+						}
+					}
+				}
+			}
+			return true
+		})
+		b.WriteString(program[last:start])
+		b.WriteString(strings.Join(parts, "; "))
+		b.WriteString(strings.Repeat("\n", strings.Count(program[start:end], "\n")))
+		last = end
+	}
+	b.WriteString(program[last:])
+
+	var pkgNames []string
+	for name := range usedPackages {
+		pkgNames = append(pkgNames, name)
+	}
+	sort.Strings(pkgNames)
+	for _, name := range pkgNames {
+		b.WriteString("\n" + usedPackages[name] + "\n")
+	}
+	return b.String(), keepHarness, run
+}
+
+// packageUse returns a declaration using a member of a package, so that its import is
+// still used once the statements using it are left out.
+func packageUse(pkg string, obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.TypeName:
+		if named, ok := o.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+			return ""
+		}
+		return fmt.Sprintf("var _ *%s.%s", pkg, o.Name())
+	case *types.Func:
+		if sig, ok := o.Type().(*types.Signature); ok && sig.TypeParams().Len() > 0 {
+			return ""
+		}
+		return fmt.Sprintf("var _ = %s.%s", pkg, o.Name())
+	case *types.Var, *types.Const:
+		return fmt.Sprintf("var _ = %s.%s", pkg, o.Name())
+	}
+	return ""
+}
+
+// keepFinish records the values saved by a successful run, and drops them otherwise.
+func keepFinish(run *keepRun, success bool) {
+	for _, p := range run.plans {
+		if !p.saving {
+			continue
+		}
+		tmpPath := filepath.Join(run.dir, p.name+".gob.tmp")
+		if _, err := os.Stat(tmpPath); err != nil {
+			continue
+		}
+		if !success {
+			os.Remove(tmpPath)
+			continue
+		}
+		if err := os.Rename(tmpPath, filepath.Join(run.dir, p.name+".gob")); err != nil {
+			continue
+		}
+		data, _ := json.MarshalIndent(keepMeta{Type: p.typ, Hash: p.hash}, "", "  ")
+		ioutil.WriteFile(filepath.Join(run.dir, p.name+".json"), data, 0644)
+	}
+}
+
+// forgetState removes the saved value of a variable.
+func forgetState(name string) {
+	dir := keepStateDir()
+	for _, ext := range []string{".gob", ".json", ".gob.tmp"} {
+		os.Remove(filepath.Join(dir, name+ext))
+	}
+}
+
+// handleKeep adds variables to the kept variables, or lists them.
+func handleKeep(args []string) {
+	if len(args) == 0 {
+		if len(keptVars) == 0 {
+			fmt.Println(infoColor("No variables are kept. Usage: :keep <var> [<var>...]"))
+			return
+		}
+		var status []string
+		for _, name := range keptVars {
+			if meta, err := readKeepMeta(keepStateDir(), name); err == nil {
+				status = append(status, fmt.Sprintf("%s (saved, %s)", name, meta.Type))
+			} else {
+				status = append(status, fmt.Sprintf("%s (not saved yet)", name))
+			}
+		}
+		fmt.Println(infoColor("Kept variables: %s", strings.Join(status, ", ")))
+		return
+	}
+	for _, name := range args {
+		if !token.IsIdentifier(name) {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid variable name: %s.", name))
+			return
+		}
+	}
+	for _, name := range args {
+		found := false
+		for _, k := range keptVars {
+			found = found || k == name
+		}
+		if !found {
+			keptVars = append(keptVars, name)
+		}
+	}
+	fmt.Println(successColor("Kept variables: %s. The next :run saves them, the following ones restore them.", strings.Join(keptVars, ", ")))
+	fmt.Println(infoColor("Values are saved with encoding/gob: unexported struct fields, funcs and channels are not kept."))
+}
+
+// handleForget drops the saved values of some or all kept variables and stops keeping them.
+func handleForget(args []string) {
+	if len(args) == 0 {
+		args = keptVars
+	}
+	var kept []string
+	for _, k := range keptVars {
+		remove := false
+		for _, name := range args {
+			remove = remove || k == name
+		}
+		if !remove {
+			kept = append(kept, k)
+		}
+	}
+	for _, name := range args {
+		forgetState(name)
+	}
+	keptVars = kept
+	if len(keptVars) == 0 {
+		fmt.Println(successColor("No variables are kept anymore. The next run computes everything."))
+	} else {
+		fmt.Println(successColor("Kept variables: %s", strings.Join(keptVars, ", ")))
+	}
+}
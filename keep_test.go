@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// keepPlanOf returns the plan of a variable of a buffer.
+func keepPlanOf(t *testing.T, code, name string) (*keepAnalysis, *keepPlan, error) {
+	t.Helper()
+	program, lineMap := generateProgramMap(code)
+	a, err := analyzeKeep(program, lineMap)
+	if err != nil {
+		t.Fatalf("analyzeKeep() error = %v", err)
+	}
+	p, err := a.plan(name)
+	return a, p, err
+}
+
+func TestKeepPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		keep    string
+		lines   string // Buffer lines of the plan
+		wantErr string
+	}{
+		{
+			name:  "declaration",
+			code:  "x := 1\nprintln(x)",
+			keep:  "x",
+			lines: "line 1",
+		},
+		{
+			name:  "changes",
+			code:  "x := 1\ny := 2\nx += 3\nprintln(x, y)",
+			keep:  "x",
+			lines: "lines 1, 3",
+		},
+		{
+			name:  "values only used by the plan",
+			code:  "n := 10\ns := make([]int, n)\nprintln(len(s))",
+			keep:  "s",
+			lines: "lines 1-2",
+		},
+		{
+			name: "checks of the values",
+			code: "v, err := f()\nif err != nil {\n\tpanic(err)\n}\nprintln(v)\n" +
+				"func f() (int, error) { return 1, nil }",
+			keep:  "v",
+			lines: "lines 1-4",
+		},
+		{
+			name:  "value also used elsewhere",
+			code:  "n := 10\ns := make([]int, n)\nprintln(n, len(s))",
+			keep:  "s",
+			lines: "line 2",
+		},
+		{
+			name:    "variable declared along with it",
+			code:    "a, b := 1, 2\nprintln(a, b)",
+			keep:    "a",
+			wantErr: "b, computed along with it, is also used at line 2",
+		},
+		{
+			name:    "not declared in main",
+			code:    "println(1)",
+			keep:    "x",
+			wantErr: "it is not declared by a statement of main",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, p, err := keepPlanOf(t, tt.code, tt.keep)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("plan() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("plan() error = %v", err)
+			}
+			if got := a.bufferRanges(p.sortedStmts()); got != tt.lines {
+				t.Errorf("plan() statements = %s, want %s", got, tt.lines)
+			}
+		})
+	}
+}
+
+func TestKeepPlanHash(t *testing.T) {
+	base := "x := 1\nx += 2\ny := 3\nprintln(x, y)"
+	tests := []struct {
+		name string
+		code string
+		same bool
+	}{
+		{"unchanged", base, true},
+		{"other statement changed", "x := 1\nx += 2\ny := 4\nprintln(x, y)", true},
+		{"statement added after", base + "\nprintln(y)", true},
+		{"declaration changed", "x := 5\nx += 2\ny := 3\nprintln(x, y)", false},
+		{"change changed", "x := 1\nx += 7\ny := 3\nprintln(x, y)", false},
+		{"type changed", "x := int64(1)\nx += 2\ny := 3\nprintln(x, y)", false},
+		{"declarations changed", base + "\nfunc f() {}", false},
+	}
+	_, want, err := keepPlanOf(t, base, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, p, err := keepPlanOf(t, tt.code, "x")
+			if err != nil {
+				t.Fatalf("plan() error = %v", err)
+			}
+			if same := p.hash == want.hash; same != tt.same {
+				t.Errorf("same hash = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
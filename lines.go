@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"golang.org/x/term"
+)
+
+// parseLineNumber parses a buffer line number between min and max.
+func parseLineNumber(arg string, min, max int) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("Invalid line number: %s. Please provide a number between %d and %d.", arg, min, max)
+	}
+	return n, nil
+}
+
+// parseLineRange parses a range of buffer lines, such as 3-7, or a single line. Entries,
+// such as #2 or #2-4, stand for the lines they cover.
+func parseLineRange(arg string, max int) (int, int, error) {
+	if max == 0 {
+		return 0, 0, errors.New("The code buffer is empty.")
+	}
+	if strings.HasPrefix(arg, "#") {
+		return parseEntryRange(arg, bufferEntries, max)
+	}
+	from, to, isRange := strings.Cut(arg, "-")
+	first, err := parseLineNumber(from, 1, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	last, err := parseLineNumber(to, 1, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("Invalid line range: %s. The first line must come before the last one.", arg)
+	}
+	return first, last, nil
+}
+
+// printCodeBuffer displays the buffer with line numbers and syntax highlighting.
+func printCodeBuffer(codeLines []string) {
+	if len(codeLines) == 0 {
+		fmt.Println(infoColor("Code buffer is empty."))
+		return
+	}
+	printCodeRange(codeLines, 1, len(codeLines))
+}
+
+// printCodeRange displays buffer lines from first to last. When the buffer has imports,
+// declarations and statements, a title starts each of their sections.
+func printCodeRange(codeLines []string, first, last int) {
+	title := " Current Code Buffer "
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < len(title) {
+		// Fallback to a default width if getting terminal size fails
+		width = 80
+	}
+	padding := (width - len(title)) / 2
+
+	header := strings.Repeat("-", padding) + title + strings.Repeat("-", width-padding-len(title))
+	footer := strings.Repeat("-", width)
+	parts := bufferSections(codeLines)
+	sections := slices.ContainsFunc(parts, func(p codePart) bool { return p != parts[0] })
+	numbered := strings.SplitAfter(formatHighlighted(codeLines, first, last), "\n")
+	var b strings.Builder
+	b.WriteString(infoColor(header) + "\n")
+	for n := first; n <= last; n++ {
+		if title, ok := partTitles[parts[n-1]]; sections && ok && (n == first || parts[n-1] != parts[n-2]) {
+			b.WriteString(infoColor("      -- %s --", title) + "\n")
+		}
+		b.WriteString(numbered[n-first])
+	}
+	b.WriteString(infoColor(footer) + "\n")
+	page(b.String())
+}
+
+// handleShow displays the buffer, a range of its lines such as :show 20-40, or the
+// declaration of a name such as :show main or :show T.String.
+func handleShow(codeLines []string, args []string) {
+	if len(args) == 0 || len(codeLines) == 0 {
+		printCodeBuffer(codeLines)
+		return
+	}
+	if len(args) != 1 {
+		fmt.Println(infoColor("Usage: :show [<first>-<last>|#<entry>|<name>]"))
+		return
+	}
+	if args[0][0] >= '0' && args[0][0] <= '9' || args[0][0] == '#' {
+		first, last, err := parseLineRange(args[0], len(codeLines))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errorColor("%v", err))
+			return
+		}
+		printCodeRange(codeLines, first, last)
+		return
+	}
+	found := findDeclarations(codeLines, []string{args[0]})
+	if len(found) == 0 {
+		fmt.Fprintln(os.Stderr, errorColor("No declaration of %s in the buffer.", args[0]))
+		return
+	}
+	for _, d := range found {
+		printCodeRange(codeLines, d.first, d.last)
+	}
+}
+
+// handleDeleteLines deletes a line or a range of lines, such as :d 3-7, and returns the buffer.
+func handleDeleteLines(codeLines []string, args []string) []string {
+	if len(args) != 1 {
+		fmt.Println(infoColor("Usage: :delete <line>|<first>-<last>|#<entry>"))
+		return codeLines
+	}
+	first, last, err := parseLineRange(args[0], len(codeLines))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("%v", err))
+		return codeLines
+	}
+	codeLines = append(codeLines[:first-1], codeLines[last:]...)
+	bufferDirty = true
+	fmt.Println(successColor("Deleted %s. Current buffer:", lineRange(first, last)))
+	printCodeBuffer(codeLines)
+	return codeLines
+}
+
+// handleMoveLines moves, or copies, a range of lines after a line, 0 being before the first
+// one, such as :m 3-5 10, and returns the buffer.
+func handleMoveLines(codeLines []string, args []string, copyLines bool) []string {
+	if len(args) != 2 {
+		if copyLines {
+			fmt.Println(infoColor("Usage: :c <first>[-<last>] <after_line>"))
+		} else {
+			fmt.Println(infoColor("Usage: :m <first>[-<last>] <after_line>"))
+		}
+		return codeLines
+	}
+	first, last, err := parseLineRange(args[0], len(codeLines))
+	if err == nil {
+		var after int
+		after, err = parseLineNumber(args[1], 0, len(codeLines))
+		if err == nil && !copyLines && after >= first-1 && after <= last {
+			if after == first-1 || after == last {
+				fmt.Println(infoColor("The lines are already there."))
+				return codeLines
+			}
+			err = errors.New("Cannot move lines after one of them.")
+		}
+		if err == nil {
+			lines := append([]string(nil), codeLines[first-1:last]...)
+			var result []string
+			for i := 0; i <= len(codeLines); i++ {
+				if i == after {
+					result = append(result, lines...)
+				}
+				if i < len(codeLines) && (copyLines || i < first-1 || i >= last) {
+					result = append(result, codeLines[i])
+				}
+			}
+			bufferDirty = true
+			if copyLines {
+				fmt.Println(successColor("Copied %s after line %d. Current buffer:", lineRange(first, last), after))
+			} else {
+				fmt.Println(successColor("Moved %s after line %d. Current buffer:", lineRange(first, last), after))
+			}
+			printCodeBuffer(result)
+			return result
+		}
+	}
+	fmt.Fprintln(os.Stderr, errorColor("%v", err))
+	return codeLines
+}
+
+// handleJoinLines joins a range of lines into the first one, such as :j 4-6, and returns
+// the buffer. A single line is joined with the next one.
+func handleJoinLines(codeLines []string, args []string) []string {
+	if len(args) != 1 {
+		fmt.Println(infoColor("Usage: :j <first>[-<last>]"))
+		return codeLines
+	}
+	first, last, err := parseLineRange(args[0], len(codeLines))
+	if err == nil && first == last {
+		if last == len(codeLines) {
+			err = fmt.Errorf("Line %d is the last line, there is no next line to join.", last)
+		}
+		last++
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("%v", err))
+		return codeLines
+	}
+	joined := strings.TrimRight(codeLines[first-1], " \t")
+	for _, line := range codeLines[first:last] {
+		if line = strings.TrimSpace(line); line != "" {
+			joined += " " + line
+		}
+	}
+	codeLines = append(append(codeLines[:first-1], joined), codeLines[last:]...)
+	bufferDirty = true
+	fmt.Println(successColor("Joined %s. Current buffer:", lineRange(first, last)))
+	printCodeBuffer(codeLines)
+	return codeLines
+}
+
+// handleAppendLines reads lines until a blank one and inserts them after a line, 0 being
+// before the first one, such as :a 4, and returns the buffer. Each line is pre-filled with
+// the indentation of the line before it.
+func handleAppendLines(rl *readline.Instance, codeLines []string, args []string) []string {
+	if len(args) != 1 {
+		fmt.Println(infoColor("Usage: :a <after_line>"))
+		return codeLines
+	}
+	after, err := parseLineNumber(args[0], 0, len(codeLines))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("%v", err))
+		return codeLines
+	}
+	fmt.Println(infoColor("Enter the lines to insert after line %d, and a blank line to end.", after))
+	var lines []string
+	previous := ""
+	if after > 0 {
+		previous = codeLines[after-1]
+	}
+	for {
+		rl.SetPrompt(fmt.Sprintf("%4d+ ", after+len(lines)+1))
+		indent := previous[:len(previous)-len(strings.TrimLeft(previous, " \t"))]
+		input, err := rl.ReadlineWithDefault(indent)
+		if err == readline.ErrInterrupt {
+			fmt.Println(infoColor("No line inserted."))
+			return codeLines
+		}
+		if err != nil || strings.TrimSpace(input) == "" {
+			break
+		}
+		lines = append(lines, input)
+		previous = input
+	}
+	if len(lines) == 0 {
+		fmt.Println(infoColor("No line inserted."))
+		return codeLines
+	}
+	codeLines = append(codeLines[:after], append(lines, codeLines[after:]...)...)
+	bufferDirty = true
+	fmt.Println(successColor("Inserted %s. Current buffer:", lineRange(after+1, after+len(lines))))
+	printCodeBuffer(codeLines)
+	return codeLines
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		arg         string
+		max         int
+		first, last int
+		wantErr     bool
+	}{
+		{"3", 10, 3, 3, false},
+		{"3-7", 10, 3, 7, false},
+		{"1-10", 10, 1, 10, false},
+		{"4-4", 10, 4, 4, false},
+		{"0", 10, 0, 0, true},
+		{"11", 10, 0, 0, true},
+		{"3-11", 10, 0, 0, true},
+		{"7-3", 10, 0, 0, true},
+		{"3-", 10, 0, 0, true},
+		{"-3", 10, 0, 0, true},
+		{"a", 10, 0, 0, true},
+		{"1", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			first, last, err := parseLineRange(tt.arg, tt.max)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLineRange(%q, %d) error = %v, want error %v", tt.arg, tt.max, err, tt.wantErr)
+			}
+			if first != tt.first || last != tt.last {
+				t.Errorf("parseLineRange(%q, %d) = %d, %d, want %d, %d", tt.arg, tt.max, first, last, tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestParseLineNumber(t *testing.T) {
+	tests := []struct {
+		arg      string
+		min, max int
+		want     int
+		wantErr  bool
+	}{
+		{"0", 0, 5, 0, false},
+		{"5", 0, 5, 5, false},
+		{"0", 1, 5, 0, true},
+		{"6", 1, 5, 0, true},
+		{"x", 1, 5, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseLineNumber(tt.arg, tt.min, tt.max)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseLineNumber(%q, %d, %d) = %d, %v, want %d, error %v", tt.arg, tt.min, tt.max, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// optDiagRegex matches a compiler diagnostic about the generated program.
+var optDiagRegex = regexp.MustCompile(`^(.*repl_code\.go):(\d+):(\d+): (.*)$`)
+
+// optDiag is an optimisation diagnostic reported by the compiler for a buffer line.
+type optDiag struct {
+	column  int
+	message string
+}
+
+// colorOptDiag colors a diagnostic according to what it tells about the code.
+func colorOptDiag(message string) string {
+	switch {
+	case strings.Contains(message, "escapes to heap") || strings.Contains(message, "moved to heap"):
+		return errorColor("%s", message)
+	case strings.HasPrefix(message, "Found Is"):
+		return infoColor("%s", message)
+	case strings.HasPrefix(message, "can inline") || strings.HasPrefix(message, "inlining call"):
+		return successColor("%s", message)
+	}
+	return outputColor(message)
+}
+
+// groupOptDiags groups the diagnostics of the compiler output by buffer line, dropping
+// those about the template and the ones repeated. The explanations of -m -m are kept when
+// verbose. It returns the diagnostics and how many are not explanations.
+func groupOptDiags(output string, lineMap []int, verbose bool) (map[int][]optDiag, int) {
+	diags := make(map[int][]optDiag)
+	seen := make(map[string]bool)
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		matches := optDiagRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		generatedLine, _ := strconv.Atoi(matches[2])
+		column, _ := strconv.Atoi(matches[3])
+		message := matches[4]
+		n := bufferLine(lineMap, generatedLine)
+		if n == 0 {
+			continue
+		}
+		// The explanations of -m -m are indented or introduce an explanation with a colon
+		isDetail := strings.HasPrefix(message, " ") || strings.HasSuffix(message, ":")
+		if isDetail && !verbose {
+			continue
+		}
+		if !isDetail {
+			// Drop the function body that follows "can inline f with cost N as:"
+			if i := strings.Index(message, " as: "); i >= 0 && strings.HasPrefix(message, "can inline") {
+				message = message[:i]
+			}
+		}
+		key := fmt.Sprintf("%d:%d:%s", n, column, message)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		diags[n] = append(diags[n], optDiag{column: column, message: message})
+		if !isDetail {
+			count++
+		}
+	}
+	return diags, count
+}
+
+// handleOpt compiles the buffer with the escape analysis, inlining and bounds check
+// diagnostics enabled, and displays them under the buffer lines they refer to.
+// With -v, the detailed explanations of -m -m are shown as well.
+func handleOpt(codeLines []string, args []string) {
+	verbose := false
+	for _, arg := range args {
+		if arg != "-v" {
+			fmt.Println(infoColor("Usage: :opt [-v]"))
+			return
+		}
+		verbose = true
+	}
+
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	tmpDir, _, output, err := buildProgram(program, []string{"-gcflags=-m -m -d=ssa/check_bce"})
+	if err != nil {
+		fmt.Print(outputColor(output))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// 1. Group the diagnostics by buffer line, dropping those about the template
+	diags, count := groupOptDiags(output, lineMap, verbose)
+
+	// 2. Display the buffer with the diagnostics under each line
+	var lines []string
+	for i, line := range codeLines {
+		lines = append(lines, fmt.Sprintf("%4d: %s", i+1, line))
+		lineDiags := diags[i+1]
+		sort.SliceStable(lineDiags, func(a, b int) bool { return lineDiags[a].column < lineDiags[b].column })
+		for _, d := range lineDiags {
+			lines = append(lines, fmt.Sprintf("      %3d| %s", d.column, colorOptDiag(d.message)))
+		}
+	}
+	printBoxed("Optimisations", lines)
+	fmt.Println(infoColor("%d diagnostics reported for the buffer.", count))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupOptDiags(t *testing.T) {
+	_, lineMap := generateProgramMap("x := []int{1}\nprintln(x[0])")
+	programLine := func(n int) int {
+		for i, l := range lineMap {
+			if l == n {
+				return i + 1
+			}
+		}
+		t.Fatalf("buffer line %d is not in the program", n)
+		return 0
+	}
+	diag := func(n, column int, message string) string {
+		return fmt.Sprintf("./repl_code.go:%d:%d: %s", programLine(n), column, message)
+	}
+	output := strings.Join([]string{
+		"# command-line-arguments",
+		diag(1, 12, "[]int{...} does not escape"),
+		diag(1, 12, "[]int{...} does not escape"),
+		diag(2, 10, "Found IsInBounds"),
+		diag(2, 1, "can inline f with cost 4 as: func() { }"),
+		diag(2, 10, "x escapes to heap:"),
+		diag(2, 10, "  flow: {heap} = x:"),
+		"./repl_code.go:1:1: diagnostic about the template",
+		"other.go:3:1: not about the program",
+	}, "\n")
+
+	tests := []struct {
+		name    string
+		verbose bool
+		want    map[int][]optDiag
+		count   int
+	}{
+		{"short", false, map[int][]optDiag{
+			1: {{12, "[]int{...} does not escape"}},
+			2: {{10, "Found IsInBounds"}, {1, "can inline f with cost 4"}},
+		}, 3},
+		{"verbose", true, map[int][]optDiag{
+			1: {{12, "[]int{...} does not escape"}},
+			2: {{10, "Found IsInBounds"}, {1, "can inline f with cost 4"}, {10, "x escapes to heap:"}, {10, "  flow: {heap} = x:"}},
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := groupOptDiags(output, lineMap, tt.verbose)
+			if !reflect.DeepEqual(got, tt.want) || count != tt.count {
+				t.Errorf("groupOptDiags() = %v, %d, want %v, %d", got, count, tt.want, tt.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// partTitles are the titles of the sections of the buffer shown by :show.
+var partTitles = map[codePart]string{
+	partImport:    "Imports",
+	partDecl:      "Declarations",
+	partStatement: "Main",
+}
+
+// bufferSections returns the part of the program each buffer line belongs to, for the
+// sections of :show. Blank lines belong to the section before them, and the parentheses of
+// an import group to the section after them.
+func bufferSections(codeLines []string) []codePart {
+	classified := splitCodeLines(strings.Join(codeLines, "\n"))
+	parts := make([]codePart, len(codeLines))
+	for i := range parts {
+		if i < len(classified) {
+			parts[i] = classified[i].Part
+		}
+	}
+	for i := len(parts) - 2; i >= 0; i-- {
+		if parts[i] == partNone && strings.TrimSpace(codeLines[i]) != "" {
+			parts[i] = parts[i+1]
+		}
+	}
+	for i := 1; i < len(parts); i++ {
+		if parts[i] == partNone {
+			parts[i] = parts[i-1]
+		}
+	}
+	return parts
+}
+
+// outlineEntry is a declaration listed by :outline.
+type outlineEntry struct {
+	kind        string
+	name        string
+	first, last int // Buffer lines
+}
+
+// bufferOutline returns the imports, the top-level declarations and the runs of statements
+// of main of the buffer, in the order of their lines.
+func bufferOutline(codeLines []string) ([]outlineEntry, error) {
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "repl_code.go", program, 0)
+	if file == nil {
+		return nil, err
+	}
+
+	var entries []outlineEntry
+	add := func(kind, name string, node ast.Node) {
+		first := bufferLine(lineMap, fset.Position(node.Pos()).Line)
+		last := bufferLine(lineMap, fset.Position(node.End()).Line)
+		if first > 0 && last >= first {
+			entries = append(entries, outlineEntry{kind, name, first, last})
+		}
+	}
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if imp.Name != nil {
+			path = imp.Name.Name + " " + path
+		}
+		add("import", path, imp)
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			switch {
+			case d.Recv != nil && len(d.Recv.List) > 0:
+				add("method", receiverTypeName(d.Recv.List[0].Type)+"."+d.Name.Name, d)
+			case d.Name.Name == "main":
+				// The statements of main are listed from the sections of the buffer
+			default:
+				add("func", d.Name.Name, d)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				var node ast.Node = d
+				if d.Lparen.IsValid() {
+					node = spec
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add("type", s.Name.Name, node)
+				case *ast.ValueSpec:
+					var names []string
+					for _, ident := range s.Names {
+						names = append(names, ident.Name)
+					}
+					add(d.Tok.String(), strings.Join(names, ", "), node)
+				}
+			}
+		}
+	}
+
+	// Runs of statements of main, without the blank lines ending them
+	parts := bufferSections(codeLines)
+	for first := 1; first <= len(codeLines); first++ {
+		if parts[first-1] != partStatement || strings.TrimSpace(codeLines[first-1]) == "" {
+			continue
+		}
+		last := first
+		for n := first + 1; n <= len(codeLines) && parts[n-1] == partStatement; n++ {
+			if strings.TrimSpace(codeLines[n-1]) != "" {
+				last = n
+			}
+		}
+		entries = append(entries, outlineEntry{"main", "statements", first, last})
+		first = last
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].first < entries[j].first })
+	return entries, err
+}
+
+// handleOutline lists the imports, types, functions, methods, variables, constants and
+// statements of main of the buffer with their lines.
+func handleOutline(codeLines []string) {
+	if len(codeLines) == 0 {
+		fmt.Println(infoColor("Code buffer is empty."))
+		return
+	}
+	entries, err := bufferOutline(codeLines)
+	if err != nil {
+		fmt.Println(infoColor("The buffer does not parse, the outline may be incomplete: %v", err))
+	}
+	if len(entries) == 0 {
+		fmt.Println(infoColor("No declaration found in the buffer."))
+		return
+	}
+	var rows []string
+	for _, e := range entries {
+		lines := strconv.Itoa(e.first)
+		if e.last > e.first {
+			lines = fmt.Sprintf("%d-%d", e.first, e.last)
+		}
+		rows = append(rows, fmt.Sprintf("%9s  %-7s %s", lines, e.kind, e.name))
+	}
+	printBoxed("Outline", rows)
+}
+
+// handleGoto opens the declaration of a name, such as :goto f or :goto T.String, in
+// the external editor, and replaces it by the edited lines. It returns the buffer.
+func handleGoto(codeLines []string, args []string) []string {
+	if len(args) != 1 {
+		fmt.Println(infoColor("Usage: :goto <name>"))
+		return codeLines
+	}
+	found := findDeclarations(codeLines, args)
+	if len(found) == 0 {
+		fmt.Fprintln(os.Stderr, errorColor("No declaration of %s in the buffer.", args[0]))
+		return codeLines
+	}
+	if len(found) > 1 {
+		fmt.Println(infoColor("%s is declared %d times, editing the last declaration.", args[0], len(found)))
+	}
+	d := found[len(found)-1]
+	data, ok := editLines(codeLines[d.first-1 : d.last])
+	if !ok {
+		return codeLines
+	}
+	edited := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	if slices.Equal(edited, codeLines[d.first-1:d.last]) {
+		fmt.Println(infoColor("Declaration of %s unchanged.", args[0]))
+		return codeLines
+	}
+	result := append(append(append([]string(nil), codeLines[:d.first-1]...), edited...), codeLines[d.last:]...)
+	bufferDirty = true
+	fmt.Println(successColor("Declaration of %s (%s) updated from editor.", args[0], lineRange(d.first, d.last)))
+	return result
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBufferSections(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []codePart
+	}{
+		{
+			"import group and statements",
+			[]string{"import (", "\t\"fmt\"", ")", "", "fmt.Println(1)"},
+			[]codePart{partImport, partImport, partImport, partImport, partStatement},
+		},
+		{
+			"declaration between statements",
+			[]string{"x := 1", "", "func f() {", "}", "", "println(x)"},
+			[]codePart{partStatement, partStatement, partDecl, partDecl, partDecl, partStatement},
+		},
+		{
+			"blank lines first",
+			[]string{"", "x := 1"},
+			[]codePart{partNone, partStatement},
+		},
+		{"empty", nil, []codePart{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bufferSections(tt.lines); !slices.Equal(got, tt.want) {
+				t.Errorf("bufferSections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBufferOutline(t *testing.T) {
+	lines := []string{
+		`import "fmt"`,           // 1
+		"type T struct{ n int }", // 2
+		"",                       // 3
+		"func (t T) String() string {",
+		"\treturn fmt.Sprint(t.n)",
+		"}", // 6
+		"x := T{1}",
+		"fmt.Println(x)", // 8
+		"",
+		"const (",
+		"\ta = 1",
+		"\tb, c = 2, 3",
+		")", // 13
+		"func f() {}",
+		"println(a, b, c)", // 15
+	}
+	want := []outlineEntry{
+		{"import", "fmt", 1, 1},
+		{"type", "T", 2, 2},
+		{"method", "T.String", 4, 6},
+		{"main", "statements", 7, 8},
+		{"const", "a", 11, 11},
+		{"const", "b, c", 12, 12},
+		{"func", "f", 14, 14},
+		{"main", "statements", 15, 15},
+	}
+	got, err := bufferOutline(lines)
+	if err != nil {
+		t.Fatalf("bufferOutline() error = %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("bufferOutline() =\n%+v\nwant\n%+v", got, want)
+	}
+}
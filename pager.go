@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// OUTPUT_DIR is where the full output of a run is saved when it is truncated.
+var OUTPUT_DIR = filepath.Join(os.Getenv("HOME"), ".goblin", "output")
+
+// Output settings, set with :output.
+var (
+	pagerEnabled   = true // Page the output taller than the terminal
+	maxOutputLines = 0    // Lines of the output of a run printed, 0 for all of them
+)
+
+// page prints text, through a pager when it is taller than the terminal: $PAGER, less or
+// the built-in one, in that order.
+func page(text string) {
+	stdout, stdin := int(os.Stdout.Fd()), int(os.Stdin.Fd())
+	_, height, err := term.GetSize(stdout)
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if !pagerEnabled || err != nil || height < 2 || !term.IsTerminal(stdin) || len(lines) < height {
+		fmt.Print(text)
+		return
+	}
+
+	var cmd *exec.Cmd
+	if pager := os.Getenv("PAGER"); pager != "" {
+		cmd = exec.Command("sh", "-c", pager)
+	} else if less, err := exec.LookPath("less"); err == nil {
+		cmd = exec.Command(less, "-R")
+	}
+	if cmd != nil {
+		cmd.Stdin = strings.NewReader(text)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err == nil {
+			return
+		}
+		fmt.Fprintln(os.Stderr, errorColor("Pager failed: %v. Using the built-in one.", err))
+	}
+	builtinPager(lines, height)
+}
+
+// builtinPager prints lines a page at a time: space shows the next page, enter the next
+// line and q stops.
+func builtinPager(lines []string, height int) {
+	shown, next := 0, height-1
+	for {
+		for ; shown < len(lines) && next > 0; shown, next = shown+1, next-1 {
+			fmt.Println(lines[shown])
+		}
+		if shown == len(lines) {
+			return
+		}
+		fmt.Print(infoColor("-- More (%d%%) -- space: next page, enter: next line, q: quit", shown*100/len(lines)))
+		if err := setRawMode(); err != nil {
+			fmt.Println()
+			fmt.Println(strings.Join(lines[shown:], "\n"))
+			return
+		}
+		key, err := readKey()
+		restoreMode()
+		fmt.Print("\r\033[K")
+		switch {
+		case err != nil || key == 'q' || key == 'Q' || key == 3 || key == 27: // Ctrl+C, Esc
+			return
+		case key == '\r' || key == '\n' || key == 'j':
+			next = 1
+		default:
+			next = height - 1
+		}
+	}
+}
+
+// limitOutput truncates the output of a run to maxOutputLines, saving the full output to
+// a file. It returns the output to print and a note telling where the full output is.
+func limitOutput(output string) (string, string) {
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if maxOutputLines <= 0 || len(lines) <= maxOutputLines {
+		return output, ""
+	}
+	truncated := strings.Join(lines[:maxOutputLines], "")
+	if err := os.MkdirAll(OUTPUT_DIR, 0755); err != nil {
+		return truncated, fmt.Sprintf("Output truncated to %d of %d lines. Error saving the full output: %v", maxOutputLines, len(lines), err)
+	}
+	path := filepath.Join(OUTPUT_DIR, fmt.Sprintf("output_%s.txt", time.Now().Format("20060102_150405")))
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return truncated, fmt.Sprintf("Output truncated to %d of %d lines. Error saving the full output: %v", maxOutputLines, len(lines), err)
+	}
+	return truncated, fmt.Sprintf("Output truncated to %d of %d lines. The full output is in %s.", maxOutputLines, len(lines), path)
+}
+
+// handleOutput shows or changes the output settings: :output pager on|off and
+// :output max <lines>|off.
+func handleOutput(args []string) {
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && args[0] == "pager" && (args[1] == "on" || args[1] == "off"):
+		pagerEnabled = args[1] == "on"
+	case len(args) == 2 && args[0] == "max" && args[1] == "off":
+		maxOutputLines = 0
+	case len(args) == 2 && args[0] == "max":
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid number of lines: %s.", args[1]))
+			return
+		}
+		maxOutputLines = n
+	default:
+		fmt.Println(infoColor("Usage: :output [pager on|off] or :output [max <lines>|off]"))
+		return
+	}
+	pager := "off"
+	if pagerEnabled {
+		pager = "on"
+	}
+	maxLines := "off"
+	if maxOutputLines > 0 {
+		maxLines = fmt.Sprintf("%d lines", maxOutputLines)
+	}
+	fmt.Println(successColor("Pager: %s. Max output: %s.", pager, maxLines))
+}
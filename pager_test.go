@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimitOutput(t *testing.T) {
+	defer func(dir string, max int) { OUTPUT_DIR, maxOutputLines = dir, max }(OUTPUT_DIR, maxOutputLines)
+	OUTPUT_DIR = t.TempDir()
+
+	tests := []struct {
+		name   string
+		max    int
+		output string
+		want   string
+		saved  bool
+	}{
+		{"no limit", 0, "a\nb\nc\n", "a\nb\nc\n", false},
+		{"under the limit", 3, "a\nb\nc\n", "a\nb\nc\n", false},
+		{"truncated", 2, "a\nb\nc\n", "a\nb\n", true},
+		{"last line without newline", 2, "a\nb\nc", "a\nb\n", true},
+		{"empty", 1, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxOutputLines = tt.max
+			got, note := limitOutput(tt.output)
+			if got != tt.want {
+				t.Errorf("limitOutput() = %q, want %q", got, tt.want)
+			}
+			if (note != "") != tt.saved {
+				t.Fatalf("limitOutput() note = %q, want a note %v", note, tt.saved)
+			}
+			if !tt.saved {
+				return
+			}
+			path := strings.TrimSuffix(note[strings.Index(note, OUTPUT_DIR):], ".")
+			if data, err := os.ReadFile(path); err != nil || string(data) != tt.output {
+				t.Errorf("saved output = %q, %v, want %q", data, err, tt.output)
+			}
+		})
+	}
+	if files, _ := filepath.Glob(filepath.Join(OUTPUT_DIR, "output_*.txt")); len(files) == 0 {
+		t.Errorf("no output saved in %s", OUTPUT_DIR)
+	}
+}
+
+func TestHandleOutput(t *testing.T) {
+	defer func(pager bool, max int) { pagerEnabled, maxOutputLines = pager, max }(pagerEnabled, maxOutputLines)
+
+	tests := []struct {
+		args  []string
+		pager bool
+		max   int
+	}{
+		{[]string{"pager", "off"}, false, 0},
+		{[]string{"pager", "on"}, true, 0},
+		{[]string{"max", "50"}, true, 50},
+		{[]string{}, true, 50},
+		{[]string{"max", "0"}, true, 50},
+		{[]string{"max", "x"}, true, 50},
+		{[]string{"pager", "maybe"}, true, 50},
+		{[]string{"max", "off"}, true, 0},
+	}
+	pagerEnabled, maxOutputLines = true, 0
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			handleOutput(tt.args)
+			if pagerEnabled != tt.pager || maxOutputLines != tt.max {
+				t.Errorf("after :output %s, pager = %v and max = %d, want %v and %d",
+					strings.Join(tt.args, " "), pagerEnabled, maxOutputLines, tt.pager, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/chzyer/readline"
+	"golang.org/x/term"
+)
+
+// Sequences of the bracketed paste mode of the terminal, which surrounds pasted text
+// with pasteStart and pasteEnd when enabled.
+const (
+	pasteModeOn  = "\x1b[?2004h"
+	pasteModeOff = "\x1b[?2004l"
+	pasteStart   = "\x1b[200~"
+	pasteEnd     = "\x1b[201~"
+)
+
+// pasteReader reads the standard input for readline, which does not know the bracketed
+// paste sequences. The pasted text is kept aside and replaced by a carriage return, so that
+// readline returns the line being typed and the text is added to the buffer as a whole.
+type pasteReader struct {
+	r      *bufio.Reader
+	mu     sync.Mutex
+	text   []byte // Pasted text not taken yet
+	pasted bool
+}
+
+// stdinPaste is the standard input given to readline.
+var stdinPaste = newPasteReader(os.Stdin)
+
+func newPasteReader(r io.Reader) *pasteReader {
+	return &pasteReader{r: bufio.NewReader(r)}
+}
+
+// Read implements io.Reader.
+func (pr *pasteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b, err := pr.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	// The start sequence comes in a single write of the terminal, a lone escape key is
+	// passed through without waiting for more input
+	if b == pasteStart[0] && pr.r.Buffered() >= len(pasteStart)-1 {
+		if next, _ := pr.r.Peek(len(pasteStart) - 1); string(next) == pasteStart[1:] {
+			pr.r.Discard(len(next))
+			pr.readPaste()
+			p[0] = '\r'
+			return 1, nil
+		}
+	}
+	p[0] = b
+	n := 1
+	for n < len(p) && pr.r.Buffered() > 0 {
+		next, _ := pr.r.Peek(1)
+		if next[0] == pasteStart[0] {
+			break
+		}
+		p[n], _ = pr.r.ReadByte()
+		n++
+	}
+	return n, nil
+}
+
+// readPaste reads pasted text up to the end sequence.
+func (pr *pasteReader) readPaste() {
+	var text []byte
+	for !bytes.HasSuffix(text, []byte(pasteEnd)) {
+		b, err := pr.r.ReadByte()
+		if err != nil {
+			break
+		}
+		text = append(text, b)
+	}
+	text = bytes.TrimSuffix(text, []byte(pasteEnd))
+	// Terminals send the line breaks of pasted text as carriage returns
+	text = bytes.ReplaceAll(text, []byte("\r\n"), []byte("\n"))
+	text = bytes.ReplaceAll(text, []byte("\r"), []byte("\n"))
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.text = append(pr.text, text...)
+	pr.pasted = true
+}
+
+// take returns the text pasted since the last call, if any.
+func (pr *pasteReader) take() (string, bool) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	text, pasted := string(pr.text), pr.pasted
+	pr.text, pr.pasted = nil, false
+	return text, pasted
+}
+
+// bracketedPaste enables or disables the bracketed paste mode of the terminal. It is only
+// enabled while a line of the buffer is read, so that commands run from goblin and the
+// other prompts get pasted text as usual.
+func bracketedPaste(enabled bool) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return
+	}
+	if enabled {
+		fmt.Print(pasteModeOn)
+	} else {
+		fmt.Print(pasteModeOff)
+	}
+}
+
+// addPaste adds pasted text of several lines to the buffer as a single entry, whatever
+// the lines look like, even commands. The text of a whole main package is unwrapped first.
+func addPaste(rl *readline.Instance, codeLines []string, entry []string, text string) ([]string, []string) {
+	lines := strings.Split(text, "\n")
+	if len(entry) == 0 {
+		if unwrapped, ok := unwrapProgram(text); ok {
+			fmt.Println(infoColor("Main package of %d lines unwrapped into %d buffer lines.", len(lines), len(unwrapped)))
+			lines = unwrapped
+		}
+	}
+	return addEntryLine(rl, codeLines, entry, lines...)
+}
+
+// unwrapProgram turns the source of a whole main package into buffer lines: the imports,
+// the declarations other than main, then the body of main. It reports false when the text
+// is not a main package.
+func unwrapProgram(text string) ([]string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", text, parser.ParseComments)
+	if err != nil || file.Name.Name != "main" {
+		return nil, false
+	}
+	source := func(from, to token.Pos) string {
+		return text[fset.Position(from).Offset:fset.Position(to).Offset]
+	}
+
+	var lines, body []string
+	for _, imp := range file.Imports {
+		if imp.Name != nil {
+			// Only import groups can name the imported package in the buffer
+			lines = append(lines, "import (", "\t"+imp.Name.Name+" "+imp.Path.Value, ")")
+		} else {
+			lines = append(lines, "import "+imp.Path.Value)
+		}
+	}
+	for _, decl := range file.Decls {
+		var doc *ast.CommentGroup
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			doc = d.Doc
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name == "main" {
+				if d.Body != nil {
+					body = mainBodyLines(source(d.Body.Lbrace+1, d.Body.Rbrace))
+				}
+				continue
+			}
+			doc = d.Doc
+		}
+		from := decl.Pos()
+		if doc != nil {
+			from = doc.Pos()
+		}
+		lines = append(lines, strings.Split(source(from, decl.End()), "\n")...)
+	}
+	return append(lines, body...), true
+}
+
+// mainBodyLines returns the lines of the body of main without the indentation they share.
+// The lines continuing a raw string or a comment are left as they are.
+func mainBodyLines(body string) []string {
+	// Lines on which a token starts, the others continue a raw string or a comment
+	starts := make(map[int]bool)
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", -1, len(body)), []byte(body), nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // Inserted at the end of a line
+		}
+		starts[fset.Position(pos).Line-1] = true
+	}
+
+	lines := strings.Split(body, "\n")
+	indent, found := "", false
+	for i, line := range lines {
+		if i == 0 || !starts[i] {
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			indent, found = lineIndent, true
+		}
+		for !strings.HasPrefix(lineIndent, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	for i, line := range lines {
+		if i > 0 && starts[i] {
+			lines[i] = strings.TrimPrefix(line, indent)
+		}
+	}
+
+	// Code following the opening brace on its line has no indentation
+	lines[0] = strings.TrimSpace(lines[0])
+	if lines[0] == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUnwrapProgram(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+		ok   bool
+	}{
+		{
+			name: "imports, declarations and main",
+			text: "package main\n\nimport (\n\t\"fmt\"\n\tstr \"strings\"\n)\n\n// T is a type.\ntype T int\n\nfunc main() {\n\tx := T(1)\n\tfmt.Println(str.Repeat(\"a\", int(x)))\n}\n",
+			want: []string{
+				`import "fmt"`,
+				"import (", "\tstr \"strings\"", ")",
+				"// T is a type.", "type T int",
+				"x := T(1)",
+				`fmt.Println(str.Repeat("a", int(x)))`,
+			},
+			ok: true,
+		},
+		{
+			name: "nested blocks keep their relative indentation",
+			text: "package main\nfunc main() {\n    for {\n        break\n    }\n}",
+			want: []string{"for {", "    break", "}"},
+			ok:   true,
+		},
+		{
+			name: "raw string continuation lines",
+			text: "package main\nfunc main() {\n\ts := `a\n  b\nc`\n\tprintln(s)\n}",
+			want: []string{"s := `a", "  b", "c`", "println(s)"},
+			ok:   true,
+		},
+		{
+			name: "code after the opening brace",
+			text: "package main\nfunc main() { println(1)\n}",
+			want: []string{"println(1)"},
+			ok:   true,
+		},
+		{
+			name: "empty main",
+			text: "package main\nfunc main() {}",
+			want: nil,
+			ok:   true,
+		},
+		{
+			name: "other package",
+			text: "package lib\nfunc F() {}",
+			ok:   false,
+		},
+		{
+			name: "not a package",
+			text: "x := 1\nprintln(x)",
+			ok:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := unwrapProgram(tt.text)
+			if ok != tt.ok {
+				t.Fatalf("unwrapProgram() ok = %v, want %v", ok, tt.ok)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("unwrapProgram() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// This file holds a small reader for the pprof profile format (profile.proto),
+// enough to aggregate samples by function and by line.
+
+// profileFrame is a function and line of a sampled stack.
+type profileFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// profileSample is one sample of a profile: a stack, innermost frame first, and its values.
+type profileSample struct {
+	Stack  []profileFrame
+	Values []int64
+}
+
+// profileData is a decoded pprof profile.
+type profileData struct {
+	SampleTypes []string // Sample types as "type/unit"
+	Samples     []profileSample
+	Duration    int64 // Duration of the profile in nanoseconds
+}
+
+// protoField is a field of a protobuf message.
+type protoField struct {
+	num   int
+	wire  int
+	value uint64 // Value of varint and fixed fields
+	data  []byte // Content of length-delimited fields
+}
+
+var errBadProto = errors.New("malformed profile data")
+
+// decodeProto splits a protobuf message into its fields.
+func decodeProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errBadProto
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case 0: // varint
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errBadProto
+			}
+			f.value = v
+			b = b[n:]
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return nil, errBadProto
+			}
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errBadProto
+			}
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return nil, errBadProto
+			}
+			f.value = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return nil, errBadProto
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// protoInts returns the integers of a repeated scalar field, which may be packed or not.
+func protoInts(f protoField) ([]uint64, error) {
+	if f.wire != 2 {
+		return []uint64{f.value}, nil
+	}
+	var values []uint64
+	b := f.data
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errBadProto
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, nil
+}
+
+// readProfile reads a pprof profile file, compressed or not.
+func readProfile(path string) (*profileData, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	return parseProfile(data)
+}
+
+// parseProfile decodes an uncompressed pprof profile.
+func parseProfile(data []byte) (*profileData, error) {
+	fields, err := decodeProto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	type line struct{ function, line uint64 }
+	type function struct{ name, file uint64 }
+	var (
+		strs        []string
+		sampleTypes [][2]uint64
+		rawSamples  []protoField
+		locations   = map[uint64][]line{}
+		functions   = map[uint64]function{}
+		prof        = &profileData{}
+	)
+
+	for _, f := range fields {
+		switch f.num {
+		case 1: // sample_type
+			sub, err := decodeProto(f.data)
+			if err != nil {
+				return nil, err
+			}
+			var vt [2]uint64
+			for _, sf := range sub {
+				if sf.num == 1 || sf.num == 2 {
+					vt[sf.num-1] = sf.value
+				}
+			}
+			sampleTypes = append(sampleTypes, vt)
+		case 2: // sample, decoded once the locations are known
+			rawSamples = append(rawSamples, f)
+		case 4: // location
+			sub, err := decodeProto(f.data)
+			if err != nil {
+				return nil, err
+			}
+			var id uint64
+			var lines []line
+			for _, sf := range sub {
+				switch sf.num {
+				case 1:
+					id = sf.value
+				case 4:
+					lf, err := decodeProto(sf.data)
+					if err != nil {
+						return nil, err
+					}
+					var l line
+					for _, x := range lf {
+						if x.num == 1 {
+							l.function = x.value
+						} else if x.num == 2 {
+							l.line = x.value
+						}
+					}
+					lines = append(lines, l)
+				}
+			}
+			locations[id] = lines
+		case 5: // function
+			sub, err := decodeProto(f.data)
+			if err != nil {
+				return nil, err
+			}
+			var id uint64
+			var fn function
+			for _, sf := range sub {
+				switch sf.num {
+				case 1:
+					id = sf.value
+				case 2:
+					fn.name = sf.value
+				case 4:
+					fn.file = sf.value
+				}
+			}
+			functions[id] = fn
+		case 6: // string_table
+			strs = append(strs, string(f.data))
+		case 10: // duration_nanos
+			prof.Duration = int64(f.value)
+		}
+	}
+
+	str := func(i uint64) string {
+		if i < uint64(len(strs)) {
+			return strs[i]
+		}
+		return ""
+	}
+	for _, vt := range sampleTypes {
+		prof.SampleTypes = append(prof.SampleTypes, str(vt[0])+"/"+str(vt[1]))
+	}
+
+	for _, f := range rawSamples {
+		sub, err := decodeProto(f.data)
+		if err != nil {
+			return nil, err
+		}
+		var s profileSample
+		for _, sf := range sub {
+			switch sf.num {
+			case 1: // location_id
+				ids, err := protoInts(sf)
+				if err != nil {
+					return nil, err
+				}
+				for _, id := range ids {
+					// Lines of a location go from the innermost inlined call outwards
+					for _, l := range locations[id] {
+						fn := functions[l.function]
+						s.Stack = append(s.Stack, profileFrame{Function: str(fn.name), File: str(fn.file), Line: int(l.line)})
+					}
+				}
+			case 2: // value
+				values, err := protoInts(sf)
+				if err != nil {
+					return nil, err
+				}
+				for _, v := range values {
+					s.Values = append(s.Values, int64(v))
+				}
+			}
+		}
+		prof.Samples = append(prof.Samples, s)
+	}
+
+	if len(prof.SampleTypes) == 0 {
+		return nil, fmt.Errorf("%w: no sample types", errBadProto)
+	}
+	return prof, nil
+}
+
+// sampleIndex returns the index of the first sample type found among names ("type/unit"
+// or just "type"), defaulting to the last sample type of the profile.
+func (p *profileData) sampleIndex(names ...string) int {
+	for _, name := range names {
+		for i, st := range p.SampleTypes {
+			if typ, _, _ := strings.Cut(st, "/"); st == name || typ == name {
+				return i
+			}
+		}
+	}
+	return len(p.SampleTypes) - 1
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime/pprof"
+	"testing"
+)
+
+// protoVarint and protoBytes encode a protobuf field.
+func protoVarint(num int, v uint64) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func protoBytes(num int, data ...[]byte) []byte {
+	content := bytes.Join(data, nil)
+	b := binary.AppendUvarint(nil, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(content)))
+	return append(b, content...)
+}
+
+func TestParseProfile(t *testing.T) {
+	strs := [][]byte{
+		protoBytes(6, nil),
+		protoBytes(6, []byte("samples")),
+		protoBytes(6, []byte("count")),
+		protoBytes(6, []byte("main.work")),
+		protoBytes(6, []byte("repl_code.go")),
+		protoBytes(6, []byte("main.main")),
+	}
+	profile := bytes.Join(append([][]byte{
+		protoBytes(1, protoVarint(1, 1), protoVarint(2, 2)),
+		// Location 1 is main.work inlined in main.main
+		protoBytes(4, protoVarint(1, 1),
+			protoBytes(4, protoVarint(1, 1), protoVarint(2, 12)),
+			protoBytes(4, protoVarint(1, 2), protoVarint(2, 20))),
+		protoBytes(5, protoVarint(1, 1), protoVarint(2, 3), protoVarint(4, 4)),
+		protoBytes(5, protoVarint(1, 2), protoVarint(2, 5), protoVarint(4, 4)),
+		// Sample with a packed location and a value which is not packed
+		protoBytes(2, protoBytes(1, binary.AppendUvarint(nil, 1)), protoVarint(2, 7)),
+		protoVarint(10, 1000),
+	}, strs...), nil)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"profile", profile, false},
+		{"truncated", profile[:len(profile)-3], true},
+		{"no sample types", bytes.Join(strs, nil), true},
+		{"bad wire type", []byte{0x0f}, true},
+		{"empty", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prof, err := parseProfile(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProfile() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, errBadProto) {
+					t.Errorf("parseProfile() error = %v, want %v", err, errBadProto)
+				}
+				return
+			}
+			if len(prof.SampleTypes) != 1 || prof.SampleTypes[0] != "samples/count" {
+				t.Errorf("SampleTypes = %q, want [samples/count]", prof.SampleTypes)
+			}
+			if prof.Duration != 1000 {
+				t.Errorf("Duration = %d, want 1000", prof.Duration)
+			}
+			want := []profileFrame{{"main.work", "repl_code.go", 12}, {"main.main", "repl_code.go", 20}}
+			if len(prof.Samples) != 1 || len(prof.Samples[0].Stack) != 2 ||
+				prof.Samples[0].Stack[0] != want[0] || prof.Samples[0].Stack[1] != want[1] {
+				t.Fatalf("Samples = %+v, want a sample with the stack %+v", prof.Samples, want)
+			}
+			if values := prof.Samples[0].Values; len(values) != 1 || values[0] != 7 {
+				t.Errorf("Values = %v, want [7]", values)
+			}
+		})
+	}
+}
+
+// TestParseRuntimeProfile reads a profile written by the runtime.
+func TestParseRuntimeProfile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := parseProfile(data)
+	if err != nil {
+		t.Fatalf("parseProfile() error = %v", err)
+	}
+	if len(prof.SampleTypes) != 4 || prof.SampleTypes[0] != "alloc_objects/count" {
+		t.Errorf("SampleTypes = %q, want the 4 types of a heap profile", prof.SampleTypes)
+	}
+	for _, s := range prof.Samples {
+		if len(s.Values) != len(prof.SampleTypes) {
+			t.Fatalf("sample with %d values, want %d", len(s.Values), len(prof.SampleTypes))
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PROFILES_DIR is the directory where raw profiles are kept for later use with 'go tool pprof'.
+var PROFILES_DIR = filepath.Join(os.Getenv("HOME"), ".goblin", "profiles")
+
+// profileKind describes how a kind of profile is enabled and written by the generated program.
+type profileKind struct {
+	imports     []string
+	start       string
+	stop        string
+	sampleTypes []string // Preferred sample types for the report
+}
+
+var profileKinds = map[string]profileKind{
+	"cpu": {
+		imports:     []string{"runtime/pprof"},
+		start:       "pprof.StartCPUProfile(goblinProfileFile)",
+		stop:        "pprof.StopCPUProfile()",
+		sampleTypes: []string{"cpu"},
+	},
+	"mem": {
+		imports:     []string{"runtime", "runtime/pprof"},
+		start:       "runtime.MemProfileRate = 1",
+		stop:        "runtime.GC()\n\tpprof.Lookup(\"allocs\").WriteTo(goblinProfileFile, 0)",
+		sampleTypes: []string{"alloc_space"},
+	},
+	"block": {
+		imports:     []string{"runtime", "runtime/pprof"},
+		start:       "runtime.SetBlockProfileRate(1)",
+		stop:        "pprof.Lookup(\"block\").WriteTo(goblinProfileFile, 0)",
+		sampleTypes: []string{"delay"},
+	},
+	"mutex": {
+		imports:     []string{"runtime", "runtime/pprof"},
+		start:       "runtime.SetMutexProfileFraction(1)",
+		stop:        "pprof.Lookup(\"mutex\").WriteTo(goblinProfileFile, 0)",
+		sampleTypes: []string{"delay"},
+	},
+}
+
+// profileHarnessTemplate is compiled along with the generated program. It starts profiling
+// before main runs; goblinProfileStop is deferred by main to write the profile.
+const profileHarnessTemplate = `package main
+
+import (
+	"os"
+%s)
+
+var goblinProfileFile *os.File
+
+func init() {
+	f, err := os.Create(%q)
+	if err != nil {
+		panic(err)
+	}
+	goblinProfileFile = f
+	%s
+}
+
+func goblinProfileStop() {
+	%s
+	goblinProfileFile.Close()
+}
+`
+
+// formatProfileValue formats a sample value according to its unit.
+func formatProfileValue(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).Round(time.Microsecond).String()
+	case "bytes":
+		return formatBytes(v)
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// formatBytes formats a size in bytes using binary units.
+func formatBytes(v int64) string {
+	const unit = 1024
+	if v < unit && v > -unit {
+		return fmt.Sprintf("%dB", v)
+	}
+	value, exp := float64(v), 0
+	for value >= unit*unit || value <= -unit*unit {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", value/unit, "KMGTPE"[exp])
+}
+
+// isBufferFrame reports whether a frame belongs to the generated program.
+func isBufferFrame(f profileFrame) bool {
+	return strings.HasSuffix(f.File, "repl_code.go")
+}
+
+// printProfileReport prints the top functions of a profile and the share of each buffer line.
+func printProfileReport(prof *profileData, sampleIndex int, topN int, codeLines []string, lineMap []int) {
+	_, unit, _ := strings.Cut(prof.SampleTypes[sampleIndex], "/")
+
+	type entry struct {
+		name      string
+		flat, cum int64
+	}
+	byFunc := map[string]*entry{}
+	flatByLine := map[int]int64{}
+	cumByLine := map[int]int64{}
+	var total int64
+
+	for _, s := range prof.Samples {
+		if sampleIndex >= len(s.Values) || len(s.Stack) == 0 {
+			continue
+		}
+		v := s.Values[sampleIndex]
+		total += v
+
+		seenFunc := map[string]bool{}
+		seenLine := map[int]bool{}
+		flatLineDone := false
+		for i, f := range s.Stack {
+			e := byFunc[f.Function]
+			if e == nil {
+				e = &entry{name: f.Function}
+				byFunc[f.Function] = e
+			}
+			if i == 0 {
+				e.flat += v
+			}
+			if !seenFunc[f.Function] {
+				e.cum += v
+				seenFunc[f.Function] = true
+			}
+
+			if !isBufferFrame(f) {
+				continue
+			}
+			n := bufferLine(lineMap, f.Line)
+			if n == 0 {
+				continue
+			}
+			// The innermost buffer line is the one charged for time spent in callees outside the buffer
+			if !flatLineDone {
+				flatByLine[n] += v
+				flatLineDone = true
+			}
+			if !seenLine[n] {
+				cumByLine[n] += v
+				seenLine[n] = true
+			}
+		}
+	}
+
+	if total == 0 {
+		fmt.Println(infoColor("The profile holds no samples. The snippet may have run too briefly to be sampled."))
+		return
+	}
+	percent := func(v int64) float64 { return 100 * float64(v) / float64(total) }
+
+	entries := make([]*entry, 0, len(byFunc))
+	for _, e := range byFunc {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].flat != entries[j].flat {
+			return entries[i].flat > entries[j].flat
+		}
+		if entries[i].cum != entries[j].cum {
+			return entries[i].cum > entries[j].cum
+		}
+		return entries[i].name < entries[j].name
+	})
+	if len(entries) > topN {
+		entries = entries[:topN]
+	}
+
+	rows := []string{fmt.Sprintf("%12s %7s %12s %7s  %s", "flat", "flat%", "cum", "cum%", "function")}
+	for _, e := range entries {
+		rows = append(rows, fmt.Sprintf("%12s %6.2f%% %12s %6.2f%%  %s",
+			formatProfileValue(e.flat, unit), percent(e.flat), formatProfileValue(e.cum, unit), percent(e.cum), e.name))
+	}
+	printBoxed(fmt.Sprintf("Top %d (%s, total %s)", len(entries), prof.SampleTypes[sampleIndex], formatProfileValue(total, unit)), rows)
+
+	rows = []string{fmt.Sprintf("%4s  %12s %12s %7s | %s", "line", "flat", "cum", "cum%", "code")}
+	for i, line := range codeLines {
+		cum, ok := cumByLine[i+1]
+		if !ok {
+			rows = append(rows, fmt.Sprintf("%4d: %12s %12s %7s | %s", i+1, "", "", "", line))
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("%4d: %12s %12s %6.2f%% | %s",
+			i+1, formatProfileValue(flatByLine[i+1], unit), formatProfileValue(cum, unit), percent(cum), line))
+	}
+	printBoxed("Per Line", rows)
+}
+
+// handleProfile runs the buffer with the requested kind of profiling and prints a report.
+// The raw profile is kept in PROFILES_DIR.
+func handleProfile(codeLines []string, args []string) {
+	usage := "Usage: :profile cpu|mem|block|mutex [-n <top>] [args...]"
+	if len(args) == 0 {
+		fmt.Println(infoColor(usage))
+		return
+	}
+	kindName := args[0]
+	kind, ok := profileKinds[kindName]
+	if !ok {
+		fmt.Println(infoColor(usage))
+		return
+	}
+	args = args[1:]
+	topN := 15
+	if len(args) >= 2 && args[0] == "-n" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid number of entries: %s.", args[1]))
+			return
+		}
+		topN = n
+		args = args[2:]
+	}
+
+	if err := os.MkdirAll(PROFILES_DIR, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error creating profiles directory: %v", err))
+		return
+	}
+	name := currentSnippetName
+	if name == "" {
+		name = "snippet"
+	}
+	profilePath := filepath.Join(PROFILES_DIR, fmt.Sprintf("%s_%s_%s.pprof", name, kindName, time.Now().Format("20060102_150405")))
+
+	// 1. Build the program along with the profiling harness
+	var imports strings.Builder
+	for _, imp := range kind.imports {
+		imports.WriteString("\t\"" + imp + "\"\n")
+	}
+	harness := fmt.Sprintf(profileHarnessTemplate, imports.String(), profilePath, kind.start, kind.stop)
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	program = deferInMain(program, "goblinProfileStop")
+
+	tmpDir, binPath, buildOutput, err := buildProgramFiles(program, map[string]string{"goblin_profile.go": harness}, nil, nil)
+	if err != nil {
+		fmt.Print(outputColor(buildOutput))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// 2. Run it
+	cmd := exec.Command(binPath, args...)
+	output, execErr := cmd.CombinedOutput()
+	printOutput(string(output))
+	if execErr != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Code Execution Finished with Error Status."))
+	}
+
+	// 3. Read the profile back and report
+	prof, err := readProfile(profilePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error reading profile: %v", err))
+		fmt.Println(infoColor("The profile is only written when main returns normally."))
+		return
+	}
+	printProfileReport(prof, prof.sampleIndex(kind.sampleTypes...), topN, codeLines, lineMap)
+	fmt.Println(infoColor("Raw profile saved to '%s'. Use 'go tool pprof %s' to explore it.", profilePath, profilePath))
+}
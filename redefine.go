@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+var (
+	// funcNameRegex matches the first line of a function or method declaration,
+	// capturing the receiver type of a method and the name.
+	funcNameRegex = regexp.MustCompile(`^func\s*(?:\(\s*(?:\w+\s+)?\*?\s*(\w+)(?:\[[^\]]*\])?\s*\))?\s*(\w+)`)
+	// genDeclRegex matches the first line of a single var, const or type declaration, capturing the names.
+	genDeclRegex = regexp.MustCompile(`^(?:var|const|type)\s+(\w+(?:\s*,\s*\w+)*)`)
+	// shortVarDeclRegex matches a short variable declaration, capturing the indentation,
+	// the names and what follows ':='.
+	shortVarDeclRegex = regexp.MustCompile(`^(\s*)(\w+(?:\s*,\s*\w+)*)\s*:=(.*)$`)
+)
+
+// declRange is a top-level declaration of the buffer.
+type declRange struct {
+	name        string
+	first, last int // Buffer lines
+}
+
+// startedDeclNames returns the names declared by a line starting a top-level
+// declaration. Methods are named after their receiver type, such as T.String.
+func startedDeclNames(line string) []string {
+	trimmed := strings.TrimSpace(line)
+	if matches := funcNameRegex.FindStringSubmatch(trimmed); matches != nil {
+		if matches[1] != "" {
+			return []string{matches[1] + "." + matches[2]}
+		}
+		return []string{matches[2]}
+	}
+	var names []string
+	if matches := genDeclRegex.FindStringSubmatch(trimmed); matches != nil {
+		for _, name := range strings.Split(matches[1], ",") {
+			if name = strings.TrimSpace(name); name != "_" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// receiverTypeName returns the name of the type of a method receiver.
+func receiverTypeName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(e.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(e.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// findDeclarations returns the top-level declarations of the buffer declaring one of names.
+// A declaration inside a var, const or type group only covers its own lines.
+func findDeclarations(codeLines []string, names []string) []declRange {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	fset := token.NewFileSet()
+	// A buffer with errors still gives the declarations that could be parsed
+	file, _ := parser.ParseFile(fset, "repl_code.go", program, parser.AllErrors)
+	if file == nil {
+		return nil
+	}
+
+	var found []declRange
+	add := func(name string, node ast.Node) {
+		first := bufferLine(lineMap, fset.Position(node.Pos()).Line)
+		last := bufferLine(lineMap, fset.Position(node.End()).Line)
+		if wanted[name] && first > 0 && last >= first {
+			found = append(found, declRange{name: name, first: first, last: last})
+		}
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = receiverTypeName(d.Recv.List[0].Type) + "." + name
+			}
+			add(name, d)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				var node ast.Node = d
+				if d.Lparen.IsValid() {
+					node = spec
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name.Name, node)
+				case *ast.ValueSpec:
+					for _, ident := range s.Names {
+						add(ident.Name, node)
+					}
+				}
+			}
+		}
+	}
+	return found
+}
+
+// startsTopLevel reports whether a line added to the buffer would be outside of any
+// declaration or block, so that it may start a new top-level declaration.
+func startsTopLevel(codeLines []string) bool {
+	probe := "_ = 0"
+	lines := splitCodeLines(strings.Join(append(append([]string(nil), codeLines...), probe), "\n"))
+	if lines[len(lines)-1].Part != partStatement {
+		return false
+	}
+	return statementDepth(codeLines) <= 0
+}
+
+// statementDepth returns how many blocks, parentheses and brackets the statements of
+// the buffer leave open.
+func statementDepth(codeLines []string) int {
+	var statements strings.Builder
+	for _, cl := range splitCodeLines(strings.Join(codeLines, "\n")) {
+		if cl.Part == partStatement {
+			statements.WriteString(cl.Text + "\n")
+		}
+	}
+	src := []byte(statements.String())
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	depth := 0
+	for {
+		_, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return depth
+		case token.LBRACE, token.LPAREN, token.LBRACK:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACK:
+			depth--
+		}
+	}
+}
+
+// confirmReplace asks whether the previous declarations of a name must be replaced.
+func confirmReplace(rl *readline.Instance, codeLines []string, found []declRange) bool {
+	fmt.Println(infoColor("%s is already declared in the buffer:", found[0].name))
+	for _, d := range found {
+		for n := d.first; n <= d.last; n++ {
+			fmt.Printf("%4d: %s\n", n, codeLines[n-1])
+		}
+	}
+	rl.SetPrompt(infoColor("Replace the previous declaration with the new one? (y/n) "))
+	answer, err := rl.Readline()
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return err == nil && (answer == "y" || answer == "yes")
+}
+
+// redefine applies the redefinition semantics to an entry about to be appended to the
+// buffer. An entry starting a top-level declaration of a name already declared replaces
+// the previous declaration, once confirmed. A short variable declaration in main of
+// variables which are all already declared there becomes an assignment, when the new
+// values can be assigned to them. It returns the buffer and the entry to append.
+func redefine(rl *readline.Instance, codeLines []string, entry []string) ([]string, []string) {
+	if !startsTopLevel(codeLines) {
+		return codeLines, entry
+	}
+	input := entry[0]
+	lines := splitCodeLines(strings.Join(append(append([]string(nil), codeLines...), input), "\n"))
+	part := lines[len(lines)-1].Part
+
+	// 1. A new declaration replaces the previous one with the same name
+	if part == partDecl {
+		found := findDeclarations(codeLines, startedDeclNames(input))
+		if len(found) == 0 || !confirmReplace(rl, codeLines, found) {
+			return codeLines, entry
+		}
+		sort.Slice(found, func(i, j int) bool { return found[i].first > found[j].first })
+		removed := make(map[int]bool)
+		for _, d := range found {
+			for n := d.first; n <= d.last; n++ {
+				removed[n] = true
+			}
+		}
+		var kept []string
+		for i, line := range codeLines {
+			if !removed[i+1] {
+				kept = append(kept, line)
+			}
+		}
+		bufferDirty = true
+		var ranges []string
+		for i := len(found) - 1; i >= 0; i-- {
+			if found[i].first == found[i].last {
+				ranges = append(ranges, fmt.Sprintf("line %d", found[i].first))
+			} else {
+				ranges = append(ranges, fmt.Sprintf("lines %d-%d", found[i].first, found[i].last))
+			}
+		}
+		fmt.Println(successColor("Previous declaration of %s removed (%s). The new one is added at the end of the buffer.", found[0].name, strings.Join(ranges, ", ")))
+		return kept, entry
+	}
+
+	// 2. A short variable declaration of existing variables becomes an assignment
+	matches := shortVarDeclRegex.FindStringSubmatch(input)
+	if part != partStatement || matches == nil {
+		return codeLines, entry
+	}
+	_, file, info, _, err := typeCheckProgram(generateProgram(strings.Join(codeLines, "\n")))
+	if err != nil {
+		return codeLines, entry
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil {
+		return codeLines, entry
+	}
+	scope := info.Scopes[mainFunc.Type]
+	var names []string
+	for _, name := range strings.Split(matches[2], ",") {
+		name = strings.TrimSpace(name)
+		if name == "_" {
+			continue
+		}
+		if v, ok := scope.Lookup(name).(*types.Var); !ok || v.Parent() != scope {
+			// A new variable makes the declaration valid as it is
+			return codeLines, entry
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return codeLines, entry
+	}
+	assigned := append([]string{matches[1] + matches[2] + " =" + matches[3]}, entry[1:]...)
+
+	// An entry that does not parse is turned into an assignment on the names alone
+	candidate := append(append([]string(nil), codeLines...), assigned...)
+	program, lineMap := generateProgramMap(strings.Join(candidate, "\n"))
+	if _, _, _, typeErrors, err := typeCheckProgram(program); err == nil {
+		for _, typeErr := range typeErrors {
+			if line := bufferLine(lineMap, typeErr.Fset.Position(typeErr.Pos).Line); line > len(codeLines) {
+				fmt.Println(infoColor("%s already declared in main, but the declaration cannot become an assignment: %s.", strings.Join(names, ", "), typeErr.Msg))
+				return codeLines, entry
+			}
+		}
+	}
+	fmt.Println(infoColor("%s already declared in main: the declaration was turned into an assignment.", strings.Join(names, ", ")))
+	return codeLines, assigned
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/readline"
+)
+
+// answering returns a readline instance reading the answers from text.
+func answering(t *testing.T, text string) *readline.Instance {
+	rl, err := readline.NewEx(&readline.Config{
+		Stdin:          io.NopCloser(strings.NewReader(text)),
+		Stdout:         io.Discard,
+		FuncIsTerminal: func() bool { return false },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rl.Close() })
+	return rl
+}
+
+func TestRedefine(t *testing.T) {
+	defer func(dirty bool) { bufferDirty = dirty }(bufferDirty)
+	tests := []struct {
+		name      string
+		codeLines []string
+		entry     []string
+		wantLines []string
+		wantEntry []string
+	}{
+		{
+			name:      "single-line function",
+			codeLines: []string{"func f() int { return 1 }", "println(f())"},
+			entry:     []string{"func f() int { return 2 }"},
+			wantLines: []string{"println(f())"},
+		},
+		{
+			name:      "multi-line function",
+			codeLines: []string{"func f() int {", "\treturn 1", "}", "println(f())"},
+			entry:     []string{"func f() int {", "\treturn 2", "}"},
+			wantLines: []string{"println(f())"},
+		},
+		{
+			name:      "type",
+			codeLines: []string{"type T int", "var t T"},
+			entry:     []string{"type T struct{ b int }"},
+			wantLines: []string{"var t T"},
+		},
+		{
+			name:      "method",
+			codeLines: []string{"type T int", "func (t T) String() string { return \"a\" }"},
+			entry:     []string{"func (t *T) String() string {", "\treturn \"b\"", "}"},
+			wantLines: []string{"type T int"},
+		},
+		{
+			name:      "new declaration",
+			codeLines: []string{"func f() {}"},
+			entry:     []string{"func g() {}"},
+			wantLines: []string{"func f() {}"},
+		},
+		{
+			name:      "repeated short variable declaration",
+			codeLines: []string{"x := 1", "println(x)"},
+			entry:     []string{"x := 2"},
+			wantLines: []string{"x := 1", "println(x)"},
+			wantEntry: []string{"x = 2"},
+		},
+		{
+			name:      "new variable in the declaration",
+			codeLines: []string{"x := 1", "println(x)"},
+			entry:     []string{"x, y := 2, 3"},
+			wantLines: []string{"x := 1", "println(x)"},
+		},
+		{
+			name:      "type mismatch",
+			codeLines: []string{"x := 1", "println(x)"},
+			entry:     []string{"x := \"a\""},
+			wantLines: []string{"x := 1", "println(x)"},
+		},
+		{
+			name:      "inside an open block",
+			codeLines: []string{"x := 1", "if x > 0 {"},
+			entry:     []string{"x := 2"},
+			wantLines: []string{"x := 1", "if x > 0 {"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantEntry == nil {
+				tt.wantEntry = tt.entry
+			}
+			codeLines, entry := redefine(answering(t, "y\n"), slices.Clone(tt.codeLines), slices.Clone(tt.entry))
+			if !slices.Equal(codeLines, tt.wantLines) {
+				t.Errorf("redefine() buffer = %q, want %q", codeLines, tt.wantLines)
+			}
+			if !slices.Equal(entry, tt.wantEntry) {
+				t.Errorf("redefine() entry = %q, want %q", entry, tt.wantEntry)
+			}
+		})
+	}
+}
+
+func TestRedefineDeclined(t *testing.T) {
+	codeLines := []string{"func f() {}"}
+	got, _ := redefine(answering(t, "n\n"), slices.Clone(codeLines), []string{"func f() { println() }"})
+	if !slices.Equal(got, codeLines) {
+		t.Errorf("redefine() declined = %q, want %q", got, codeLines)
+	}
+}
+
+func TestFindDeclarations(t *testing.T) {
+	codeLines := []string{
+		"import \"fmt\"",
+		"func f() {",
+		"\tfmt.Println()",
+		"}",
+		"type T int",
+		"func (t *T) Set() {}",
+		"var (",
+		"\ta = 1",
+		"\tb = 2",
+		")",
+		"f()",
+	}
+	tests := []struct {
+		names []string
+		want  []declRange
+	}{
+		{[]string{"f"}, []declRange{{"f", 2, 4}}},
+		{[]string{"T", "T.Set"}, []declRange{{"T", 5, 5}, {"T.Set", 6, 6}}},
+		{[]string{"b"}, []declRange{{"b", 9, 9}}},
+		{[]string{"main", "fmt", "x"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			if got := findDeclarations(codeLines, tt.names); !slices.Equal(got, tt.want) {
+				t.Errorf("findDeclarations(%q) = %v, want %v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartsTopLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		codeLines []string
+		want      bool
+	}{
+		{"empty buffer", nil, true},
+		{"after statements", []string{"x := 1", "println(x)"}, true},
+		{"after a declaration", []string{"func f() {", "}"}, true},
+		{"inside a function", []string{"func f() {"}, false},
+		{"inside a block of main", []string{"for {"}, false},
+		{"inside a call", []string{"println(1,"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := startsTopLevel(tt.codeLines); got != tt.want {
+				t.Errorf("startsTopLevel(%q) = %v, want %v", tt.codeLines, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+)
+
+// matchColor highlights the text matched by :find and :s.
+var matchColor = color.New(color.FgBlack, color.BgYellow).SprintFunc()
+
+// substituteRegex matches a substitute command, capturing the line range, the delimiter
+// and what follows it, such as :3-7s/old/new/g.
+var substituteRegex = regexp.MustCompile(`^:(\d+(?:-\d+)?)?s([^\w\s\\])(.*)$`)
+
+// highlightMatches returns a line with the text matched by re highlighted.
+func highlightMatches(re *regexp.Regexp, line string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(line, -1) {
+		b.WriteString(line[last:loc[0]])
+		b.WriteString(matchColor(line[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// handleFind lists the buffer lines matching a regular expression, such as :find err\b.
+func handleFind(codeLines []string, pattern string) {
+	if pattern == "" {
+		fmt.Println(infoColor("Usage: :find <regex>"))
+		return
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Invalid regular expression: %v", err))
+		return
+	}
+	found := 0
+	for i, line := range codeLines {
+		if re.MatchString(line) {
+			fmt.Printf("%4d: %s\n", i+1, highlightMatches(re, line))
+			found++
+		}
+	}
+	switch found {
+	case 0:
+		fmt.Println(infoColor("No line matches %s.", pattern))
+	case 1:
+		fmt.Println(infoColor("1 line matches."))
+	default:
+		fmt.Println(infoColor("%d lines match.", found))
+	}
+}
+
+// splitSubstitute splits what follows the delimiter of a substitute command into the
+// pattern, the replacement and the flags. A delimiter preceded by a backslash is part of
+// the pattern or the replacement.
+func splitSubstitute(s string, delim byte) ([]string, bool) {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			b.WriteByte(delim)
+			i++
+		case s[i] == delim && len(parts) < 2:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	parts = append(parts, b.String())
+	if len(parts) == 2 {
+		// The last delimiter may be left out when there are no flags
+		parts = append(parts, "")
+	}
+	return parts, len(parts) == 3
+}
+
+// handleSubstitute replaces the text matching a regular expression on a range of lines or
+// the whole buffer, such as :s/old/new/ for the first match of each line or :3-7s/old/new/g
+// for all of them. The replacement may refer to groups, such as $1. The changes are
+// previewed and applied once confirmed. It returns the buffer.
+func handleSubstitute(rl *readline.Instance, codeLines []string, line string) []string {
+	usage := "Usage: :[<first>[-<last>]]s/<regex>/<replacement>/[g]"
+	matches := substituteRegex.FindStringSubmatch(line)
+	if matches == nil {
+		fmt.Println(infoColor(usage))
+		return codeLines
+	}
+	parts, ok := splitSubstitute(matches[3], matches[2][0])
+	if !ok || parts[0] == "" || (parts[2] != "" && parts[2] != "g") {
+		fmt.Println(infoColor(usage))
+		return codeLines
+	}
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Invalid regular expression: %v", err))
+		return codeLines
+	}
+	first, last := 1, len(codeLines)
+	if matches[1] != "" {
+		if first, last, err = parseLineRange(matches[1], len(codeLines)); err != nil {
+			fmt.Fprintln(os.Stderr, errorColor("%v", err))
+			return codeLines
+		}
+	}
+	replacement, global := parts[1], parts[2] == "g"
+
+	// Preview of the changed lines
+	result := append([]string(nil), codeLines...)
+	changed := 0
+	for i := first - 1; i < last; i++ {
+		var replaced string
+		if global {
+			replaced = re.ReplaceAllString(codeLines[i], replacement)
+		} else if loc := re.FindStringSubmatchIndex(codeLines[i]); loc != nil {
+			expanded := re.ExpandString(nil, replacement, codeLines[i], loc)
+			replaced = codeLines[i][:loc[0]] + string(expanded) + codeLines[i][loc[1]:]
+		} else {
+			continue
+		}
+		if replaced == codeLines[i] {
+			continue
+		}
+		fmt.Printf("%4d: %s %s\n", i+1, errorColor("-"), highlightMatches(re, codeLines[i]))
+		fmt.Printf("%4d: %s %s\n", i+1, successColor("+"), replaced)
+		result[i] = replaced
+		changed++
+	}
+	if changed == 0 {
+		fmt.Println(infoColor("No line changed by the substitution."))
+		return codeLines
+	}
+
+	if changed == 1 {
+		rl.SetPrompt(infoColor("Apply the substitution to 1 line? (y/n) "))
+	} else {
+		rl.SetPrompt(infoColor("Apply the substitution to %d lines? (y/n) ", changed))
+	}
+	answer, err := rl.Readline()
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if err != nil || (answer != "y" && answer != "yes") {
+		fmt.Println(infoColor("Substitution cancelled."))
+		return codeLines
+	}
+	bufferDirty = true
+	if changed == 1 {
+		fmt.Println(successColor("1 line changed."))
+	} else {
+		fmt.Println(successColor("%d lines changed.", changed))
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitSubstitute(t *testing.T) {
+	tests := []struct {
+		s     string
+		delim byte
+		want  []string
+		ok    bool
+	}{
+		{"old/new/", '/', []string{"old", "new", ""}, true},
+		{"old/new/g", '/', []string{"old", "new", "g"}, true},
+		{"old/new", '/', []string{"old", "new", ""}, true},
+		{"a\\/b/c\\/d/", '/', []string{"a/b", "c/d", ""}, true},
+		{"a\\d+/x/", '/', []string{"a\\d+", "x", ""}, true},
+		{"old#new#g", '#', []string{"old", "new", "g"}, true},
+		{"//", '/', []string{"", "", ""}, true},
+		{"old/new/g/x", '/', []string{"old", "new", "g/x"}, true},
+		{"old", '/', []string{"old"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, ok := splitSubstitute(tt.s, tt.delim)
+			if ok != tt.ok {
+				t.Fatalf("splitSubstitute(%q) ok = %v, want %v", tt.s, ok, tt.ok)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitSubstitute(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstituteRegex(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string // Range, delimiter and rest, nil when not a substitution
+	}{
+		{":s/a/b/", []string{"", "/", "a/b/"}},
+		{":3-7s/a/b/g", []string{"3-7", "/", "a/b/g"}},
+		{":12s#a#b#", []string{"12", "#", "a#b#"}},
+		{":show", nil},
+		{":save x", nil},
+		{":s", nil},
+		{":sxaxbx", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			matches := substituteRegex.FindStringSubmatch(tt.line)
+			if matches != nil {
+				matches = matches[1:]
+			}
+			if !slices.Equal(matches, tt.want) {
+				t.Errorf("substituteRegex on %q = %q, want %q", tt.line, matches, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// nmSymbol is a symbol of the binary as listed by 'go tool nm -size'.
+type nmSymbol struct {
+	name string
+	size int64
+	kind string
+}
+
+// symbolPackage returns the import path of the package defining a symbol. The type
+// arguments of generic symbols, such as slices.Sort[go.shape.string], are left out, as
+// they name other packages.
+func symbolPackage(name string) string {
+	if strings.HasPrefix(name, "go:") || strings.HasPrefix(name, "type:") {
+		return "(runtime metadata)"
+	}
+	var b strings.Builder
+	depth := 0
+	for _, r := range name {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	name = b.String()
+	start := strings.LastIndex(name, "/") + 1
+	if dot := strings.Index(name[start:], "."); dot >= 0 {
+		return name[:start+dot]
+	}
+	return name
+}
+
+// readSymbols lists the symbols of a binary that take space in the file.
+func readSymbols(binPath string) ([]nmSymbol, error) {
+	out, err := exec.Command("go", "tool", "nm", "-size", binPath).Output()
+	if err != nil {
+		return nil, err
+	}
+	var symbols []nmSymbol
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		// Lines are: address size type name
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+		kind := fields[2]
+		// Uninitialized data (B) and undefined symbols (U) are not stored in the binary
+		if kind == "B" || kind == "b" || kind == "U" {
+			continue
+		}
+		symbols = append(symbols, nmSymbol{name: strings.Join(fields[3:], " "), size: size, kind: kind})
+	}
+	return symbols, scanner.Err()
+}
+
+// handleSize builds the buffer and reports the size of the binary, its largest symbols
+// and the contribution of each package.
+func handleSize(code string, args []string) {
+	topN := 15
+	if len(args) == 2 && args[0] == "-n" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid number of entries: %s.", args[1]))
+			return
+		}
+		topN = n
+	} else if len(args) != 0 {
+		fmt.Println(infoColor("Usage: :size [-n <top>]"))
+		return
+	}
+
+	tmpDir, binPath, output, err := buildProgram(generateProgram(code), nil)
+	if err != nil {
+		fmt.Print(outputColor(output))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	info, err := os.Stat(binPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error reading binary: %v", err))
+		return
+	}
+	symbols, err := readSymbols(binPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error reading symbol table: %v", err))
+		return
+	}
+
+	var symbolsTotal int64
+	byPackage := make(map[string]int64)
+	for _, sym := range symbols {
+		symbolsTotal += sym.size
+		byPackage[symbolPackage(sym.name)] += sym.size
+	}
+	percent := func(v int64) float64 { return 100 * float64(v) / float64(symbolsTotal) }
+
+	// Largest symbols
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].size > symbols[j].size })
+	shown := symbols
+	if len(shown) > topN {
+		shown = shown[:topN]
+	}
+	rows := []string{fmt.Sprintf("%10s %7s %4s  %s", "size", "%", "type", "symbol")}
+	for _, sym := range shown {
+		rows = append(rows, fmt.Sprintf("%10s %6.2f%% %4s  %s", formatBytes(sym.size), percent(sym.size), sym.kind, sym.name))
+	}
+	printBoxed(fmt.Sprintf("Largest %d Symbols", len(shown)), rows)
+
+	// Contribution of each package
+	packages := make([]string, 0, len(byPackage))
+	for pkg := range byPackage {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return byPackage[packages[i]] > byPackage[packages[j]] })
+	if len(packages) > topN {
+		packages = packages[:topN]
+	}
+	rows = []string{fmt.Sprintf("%10s %7s  %s", "size", "%", "package")}
+	for _, pkg := range packages {
+		rows = append(rows, fmt.Sprintf("%10s %6.2f%%  %s", formatBytes(byPackage[pkg]), percent(byPackage[pkg]), pkg))
+	}
+	printBoxed(fmt.Sprintf("Largest %d Packages", len(packages)), rows)
+
+	fmt.Println(infoColor("Binary size: %s (%d bytes), of which %s in %d symbols.",
+		formatBytes(info.Size()), info.Size(), formatBytes(symbolsTotal), len(symbols)))
+}
+
+// handleDeps lists the packages imported by the buffer, directly or not,
+// separating the standard library from the other modules.
+func handleDeps(code string) {
+	tmpDir, err := ioutil.TempDir("", "gorepl_tmp")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error creating temp directory: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcPath := filepath.Join(tmpDir, "repl_code.go")
+	if err := ioutil.WriteFile(srcPath, []byte(generateProgram(code)), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error writing code to temp file: %v", err))
+		return
+	}
+
+	goList := func(format string, deps bool) ([]string, error) {
+		cmdArgs := []string{"list", "-e", "-f", format}
+		if deps {
+			cmdArgs = append(cmdArgs, "-deps")
+		}
+		cmd := exec.Command("go", append(cmdArgs, srcPath)...)
+		cmd.Dir = tmpDir
+		cmd.Env = append(os.Environ(), "GOWORK=off")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("%v\n%s", err, out)
+		}
+		return strings.Fields(string(out)), nil
+	}
+
+	direct, err := goList(`{{join .Imports " "}}`, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error listing imports: %v", err))
+		return
+	}
+	all, err := goList(`{{.ImportPath}}:{{.Standard}}`, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error listing dependencies: %v", err))
+		return
+	}
+
+	var stdlib, modules []string
+	for _, entry := range all {
+		path, standard, _ := strings.Cut(entry, ":")
+		switch {
+		case path == "command-line-arguments":
+			continue
+		case standard == "true":
+			stdlib = append(stdlib, path)
+		default:
+			modules = append(modules, path)
+		}
+	}
+	sort.Strings(stdlib)
+	sort.Strings(modules)
+
+	var lines []string
+	lines = append(lines, infoColor("Direct imports (%d):", len(direct)))
+	for _, path := range direct {
+		lines = append(lines, "  "+path)
+	}
+	lines = append(lines, infoColor("Standard library (%d):", len(stdlib)))
+	for _, path := range stdlib {
+		lines = append(lines, "  "+path)
+	}
+	lines = append(lines, infoColor("Other modules (%d):", len(modules)))
+	for _, path := range modules {
+		lines = append(lines, "  "+path)
+	}
+	printBoxed("Dependencies", lines)
+	fmt.Println(infoColor("%d packages in total: %d from the standard library, %d from other modules.",
+		len(stdlib)+len(modules), len(stdlib), len(modules)))
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestSymbolPackage(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main.main", "main"},
+		{"fmt.Println", "fmt"},
+		{"encoding/json.Marshal", "encoding/json"},
+		{"github.com/fatih/color.(*Color).Sprint", "github.com/fatih/color"},
+		{"slices.Sort[go.shape.string]", "slices"},
+		{"main.Map[go.shape.struct { X encoding/json.Number },go.shape.int]", "main"},
+		{"slices.insertionSortCmpFunc[go.shape.*uint8].func1", "slices"},
+		{"go:buildinfo", "(runtime metadata)"},
+		{"type:*main.T", "(runtime metadata)"},
+		{"runtime", "runtime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := symbolPackage(tt.name); got != tt.want {
+				t.Errorf("symbolPackage(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
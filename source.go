@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// partNames are how :explain names the parts of the program buffer lines are placed in.
+var partNames = map[codePart]string{
+	partNone:      "-",
+	partImport:    "import",
+	partDecl:      "declaration",
+	partStatement: "statement",
+}
+
+// handleSource prints the program :run compiles for the buffer, with the same flags, such
+// as :source --annotate. The watched and kept variables are instrumented as for :run.
+func handleSource(codeLines []string, args []string) {
+	if len(codeLines) == 0 {
+		fmt.Println(infoColor("No code in buffer, the program would be empty."))
+		return
+	}
+	opts, rest, err := parseRunFlags(args)
+	if err != nil || len(rest) > 0 {
+		fmt.Println(infoColor("Usage: :source [--stats] [--annotate] [--deterministic] [--seed=N] [--fixed-clock]"))
+		return
+	}
+	opts.watch = watchedVars
+	opts.keep = keptVars
+
+	program := prepareProgram(strings.Join(codeLines, "\n"), opts, os.TempDir())
+	lines := strings.Split(program.code, "\n")
+	var rows []string
+	for i, line := range highlightCode(lines) {
+		from := ""
+		// The instrumentation keeps the lines in place, even when it changes them
+		if n := bufferLine(program.lineMap, i+1); n > 0 {
+			from = fmt.Sprintf("[%d]", n)
+		}
+		rows = append(rows, fmt.Sprintf("%4d %6s  %s", i+1, from, line))
+	}
+	printBoxed("repl_code.go", rows)
+	fmt.Println(infoColor("Buffer lines are shown in brackets."))
+	if len(program.harnesses) > 0 {
+		var names []string
+		for name := range program.harnesses {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println(infoColor("Compiled along with %s.", strings.Join(names, ", ")))
+	}
+}
+
+// movedOutOfMain returns the buffer lines starting a declaration which follows statements,
+// and which is placed before main all the same.
+func movedOutOfMain(lines []codeLine) map[int]bool {
+	moved := make(map[int]bool)
+	afterStatement, previous := false, partNone
+	for _, cl := range lines {
+		if cl.Part == partDecl && afterStatement && previous != partDecl {
+			moved[cl.Num] = true
+		}
+		afterStatement = afterStatement || cl.Part == partStatement
+		if cl.Part != partNone {
+			previous = cl.Part
+		}
+	}
+	return moved
+}
+
+// handleExplain shows how each buffer line is classified, and where it is placed in the
+// generated program: in the imports, among the top-level declarations, or in main.
+func handleExplain(codeLines []string) {
+	if len(codeLines) == 0 {
+		fmt.Println(infoColor("Code buffer is empty."))
+		return
+	}
+	_, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	programLines := make(map[int]int)
+	for g := len(lineMap); g >= 1; g-- {
+		if n := bufferLine(lineMap, g); n > 0 {
+			programLines[n] = g
+		}
+	}
+
+	var rows []string
+	lines := splitCodeLines(strings.Join(codeLines, "\n"))
+	moved := movedOutOfMain(lines)
+	for i, cl := range lines {
+		n := i + 1
+		part := partNames[cl.Part]
+		if cl.Part == partStatement {
+			part += " (main)"
+		}
+		to := "-"
+		if g, ok := programLines[n]; ok {
+			to = fmt.Sprintf("%d", g)
+		}
+		hint := ""
+		if moved[n] {
+			hint = "  " + infoColor("<- moved out of main")
+		}
+		rows = append(rows, fmt.Sprintf("%4d  %-17s %5s  %s%s", n, part, to, codeLines[n-1], hint))
+	}
+	printBoxed("Buffer Lines (line, part, program line, code)", rows)
+	if len(moved) > 0 {
+		fmt.Println(infoColor("Declarations of functions, types, var and const are top-level declarations, placed before main even after statements."))
+		fmt.Println(infoColor("They cannot use the variables of main: declare variables with := to keep them in main."))
+	}
+}
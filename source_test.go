@@ -0,0 +1,29 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestMovedOutOfMain(t *testing.T) {
+	tests := []struct {
+		name string
+		code []string
+		want map[int]bool
+	}{
+		{"declarations first", []string{"func f() {}", "type T int", "f()"}, map[int]bool{}},
+		{"declaration after statements", []string{"x := 1", "func f() {", "}", "println(x)"}, map[int]bool{2: true}},
+		{"group of declarations", []string{"x := 1", "type T int", "var v T", "println(x, v)"}, map[int]bool{2: true}},
+		{"blank line between", []string{"x := 1", "", "const c = 2", "", "type T int"}, map[int]bool{3: true}},
+		{"imports", []string{"import \"fmt\"", "var v = 1", "fmt.Println(v)"}, map[int]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := movedOutOfMain(splitCodeLines(strings.Join(tt.code, "\n")))
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("movedOutOfMain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
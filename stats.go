@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsHarness is compiled along with the generated program by :run --stats.
+// goblinStatsReport is deferred by main, so it runs once the statements of the buffer
+// are done, even when they panic, and writes the statistics to GOBLIN_STATS_FILE. The
+// peak heap is sampled at each garbage collection and when main returns.
+const statsHarness = `package main
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	goblinStatsStart time.Time
+	goblinStatsPeak  atomic.Uint64
+)
+
+func goblinStatsSampleHeap() {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return
+	}
+	v := sample[0].Value.Uint64()
+	for {
+		peak := goblinStatsPeak.Load()
+		if v <= peak || goblinStatsPeak.CompareAndSwap(peak, v) {
+			return
+		}
+	}
+}
+
+// goblinStatsGC samples the heap at the end of each garbage collection, when the dead
+// objects are not swept yet, and re-arms itself for the next one. Finalizers need no
+// goroutine nor timer of the program, which would keep the runtime from detecting deadlocks.
+type goblinStatsGC struct{ _ [64]byte }
+
+func goblinStatsOnGC(*goblinStatsGC) {
+	goblinStatsSampleHeap()
+	runtime.SetFinalizer(&goblinStatsGC{}, goblinStatsOnGC)
+}
+
+func init() {
+	goblinStatsStart = time.Now()
+	runtime.SetFinalizer(&goblinStatsGC{}, goblinStatsOnGC)
+}
+
+func goblinStatsReport() {
+	elapsed := time.Since(goblinStatsStart)
+	goblinStatsSampleHeap()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"elapsed_ns":  elapsed.Nanoseconds(),
+		"total_alloc": m.TotalAlloc,
+		"mallocs":     m.Mallocs,
+		"num_gc":      m.NumGC,
+		"peak_heap":   goblinStatsPeak.Load(),
+		"stacks":      string(buf),
+	})
+	os.WriteFile(os.Getenv("GOBLIN_STATS_FILE"), data, 0644)
+}
+`
+
+// runStats holds the statistics reported by a run with --stats.
+type runStats struct {
+	ElapsedNs  int64  `json:"elapsed_ns"`
+	TotalAlloc uint64 `json:"total_alloc"`
+	Mallocs    uint64 `json:"mallocs"`
+	NumGC      uint32 `json:"num_gc"`
+	PeakHeap   uint64 `json:"peak_heap"`
+	Stacks     string `json:"stacks"`
+
+	goroutines []liveGoroutine
+}
+
+// liveGoroutine is a goroutine still alive when the statements of main are done.
+type liveGoroutine struct {
+	id          int
+	state       string
+	createdBy   string
+	createdLine int // Buffer line of the go statement, 0 if created outside of the buffer
+}
+
+var (
+	goroutineHeaderRegex = regexp.MustCompile(`^goroutine (\d+) \[([^\]]*)\]:$`)
+	createdByRegex       = regexp.MustCompile(`^created by (\S+)`)
+	stackFileRegex       = regexp.MustCompile(`^\t(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// parseGoroutines reads the goroutines of a runtime.Stack dump, leaving out the one
+// running main and the ones started by the harness of goblin.
+func parseGoroutines(stacks string, lineMap []int) []liveGoroutine {
+	var goroutines []liveGoroutine
+	for _, block := range strings.Split(strings.TrimSpace(stacks), "\n\n") {
+		lines := strings.Split(block, "\n")
+		header := goroutineHeaderRegex.FindStringSubmatch(lines[0])
+		if header == nil {
+			continue
+		}
+		g := liveGoroutine{state: header[2]}
+		g.id, _ = strconv.Atoi(header[1])
+		if g.id == 1 {
+			continue
+		}
+		harness := false
+		for i, line := range lines {
+			matches := createdByRegex.FindStringSubmatch(line)
+			if matches == nil || i+1 >= len(lines) {
+				continue
+			}
+			g.createdBy = matches[1]
+			if file := stackFileRegex.FindStringSubmatch(lines[i+1]); file != nil {
+				if strings.HasSuffix(file[1], "goblin_stats.go") {
+					harness = true
+				} else if strings.HasSuffix(file[1], "repl_code.go") {
+					n, _ := strconv.Atoi(file[2])
+					g.createdLine = bufferLine(lineMap, n)
+				}
+			}
+		}
+		if !harness {
+			goroutines = append(goroutines, g)
+		}
+	}
+	return goroutines
+}
+
+// readRunStats reads the statistics written by the harness of :run --stats.
+func readRunStats(path string, lineMap []int) (*runStats, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	stats := &runStats{}
+	if err := json.Unmarshal(data, stats); err != nil {
+		return nil, err
+	}
+	stats.goroutines = parseGoroutines(stats.Stacks, lineMap)
+	return stats, nil
+}
+
+// printRunStats prints the statistics of a run with --stats.
+func printRunStats(stats *runStats, codeLines []string) {
+	if stats == nil {
+		fmt.Println(infoColor("No statistics were reported. They are only collected when main returns or panics."))
+		return
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Elapsed time:      %s", time.Duration(stats.ElapsedNs).Round(time.Microsecond)))
+	lines = append(lines, fmt.Sprintf("Total allocations: %s in %d objects", formatBytes(int64(stats.TotalAlloc)), stats.Mallocs))
+	lines = append(lines, fmt.Sprintf("Peak heap:         %s", formatBytes(int64(stats.PeakHeap))))
+	lines = append(lines, fmt.Sprintf("GC cycles:         %d", stats.NumGC))
+	if len(stats.goroutines) == 0 {
+		lines = append(lines, successColor("Goroutines alive:  none"))
+	} else {
+		lines = append(lines, errorColor("Goroutines alive:  %d", len(stats.goroutines)))
+		for _, g := range stats.goroutines {
+			site := fmt.Sprintf("created by %s outside of the buffer", g.createdBy)
+			if g.createdLine > 0 {
+				site = fmt.Sprintf("created at line %d: %s", g.createdLine, strings.TrimSpace(codeLines[g.createdLine-1]))
+			}
+			lines = append(lines, fmt.Sprintf("  goroutine %d [%s] %s", g.id, g.state, site))
+		}
+	}
+	printBoxed("Run Statistics", lines)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGoroutines(t *testing.T) {
+	program, lineMap := generateProgramMap("ch := make(chan int)\ngo func() { <-ch }()")
+	mainLine := strings.Count(program[:strings.Index(program, "go func")], "\n") + 1
+	stacks := "goroutine 1 [running]:\nmain.main()\n\t/tmp/repl_code.go:20 +0x1d\n\n" +
+		"goroutine 6 [chan receive]:\nmain.main.func1()\n\t/tmp/repl_code.go:21 +0x25\n" +
+		"created by main.main in goroutine 1\n\t/tmp/repl_code.go:" + strconv.Itoa(mainLine) + " +0x4f\n\n" +
+		"goroutine 7 [select]:\nnet/http.(*persistConn).readLoop()\n\t/go/src/net/http/transport.go:2200 +0x1\n" +
+		"created by net/http.(*Transport).dialConn in goroutine 6\n\t/go/src/net/http/transport.go:1800 +0x2\n"
+	got := parseGoroutines(stacks, lineMap)
+	want := []liveGoroutine{
+		{id: 6, state: "chan receive", createdBy: "main.main", createdLine: 2},
+		{id: 7, state: "select", createdBy: "net/http.(*Transport).dialConn"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseGoroutines() = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("goroutine %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestRunStatsDeadlock checks that the harness of --stats leaves the runtime able to
+// detect a deadlock, so that the run ends.
+func TestRunStatsDeadlock(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	done := make(chan runResult, 1)
+	go func() {
+		result, _ := executeCode("ch := make(chan int)\n<-ch", nil, runOptions{stats: true})
+		done <- result
+	}()
+	select {
+	case result := <-done:
+		if !strings.Contains(result.output, "all goroutines are asleep - deadlock!") {
+			t.Errorf("output = %q, want the deadlock error", result.output)
+		}
+	case <-time.After(2 * time.Minute):
+		t.Fatal("the run of a deadlocking buffer with --stats did not end")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stressRun is the outcome of one run of the binary during :stress.
+type stressRun struct {
+	index  int
+	output string
+	status string // "ok", "timeout" or the exit status
+}
+
+// stressGroup is a set of runs that produced the same output and status.
+type stressGroup struct {
+	output string
+	status string
+	count  int
+}
+
+// stressVolatileRegex matches the parts of an output that change from run to run even
+// when the behaviour is the same, such as addresses and goroutine numbers in race reports.
+var stressVolatileRegex = regexp.MustCompile(`0x[0-9a-f]+|(?i:goroutine) \d+`)
+
+// groupStressRuns groups the runs which produced the same output and status, once the
+// volatile parts of the outputs are left out, from the most frequent group.
+func groupStressRuns(results []stressRun) []*stressGroup {
+	groups := make(map[string]*stressGroup)
+	var ordered []*stressGroup
+	for _, res := range results {
+		key := res.status + "\x00" + stressVolatileRegex.ReplaceAllStringFunc(res.output, func(m string) string {
+			if strings.HasPrefix(m, "0x") {
+				return "0x?"
+			}
+			return m[:len("goroutine")] + " ?"
+		})
+		g, ok := groups[key]
+		if !ok {
+			g = &stressGroup{output: res.output, status: res.status}
+			groups[key] = g
+			ordered = append(ordered, g)
+		}
+		g.count++
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].count > ordered[j].count })
+	return ordered
+}
+
+// maxStressGroupLines is the number of output lines shown for each group of runs.
+const maxStressGroupLines = 10
+
+// handleStress builds the buffer once and runs the binary many times in parallel,
+// grouping the distinct outputs and exit statuses so that nondeterminism shows up.
+func handleStress(code string, args []string) {
+	usage := "Usage: :stress [-n <runs>] [-p <parallel>] [-t <timeout>] [-race] [--] [args...]"
+	runs, parallel, timeout, race := 100, runtime.NumCPU(), 10*time.Second, false
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flag := args[0]
+		args = args[1:]
+		if flag == "--" {
+			break
+		}
+		if flag == "-race" {
+			race = true
+			continue
+		}
+		if len(args) == 0 {
+			fmt.Println(infoColor(usage))
+			return
+		}
+		value := args[0]
+		args = args[1:]
+		var err error
+		switch flag {
+		case "-n":
+			runs, err = strconv.Atoi(value)
+			if err == nil && runs < 1 {
+				err = errors.New("must be positive")
+			}
+		case "-p":
+			parallel, err = strconv.Atoi(value)
+			if err == nil && parallel < 1 {
+				err = errors.New("must be positive")
+			}
+		case "-t":
+			timeout, err = time.ParseDuration(value)
+			if err == nil && timeout <= 0 {
+				err = errors.New("must be positive")
+			}
+		default:
+			fmt.Println(infoColor(usage))
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid value '%s' for %s: %v", value, flag, err))
+			return
+		}
+	}
+
+	var buildFlags []string
+	if race {
+		buildFlags = append(buildFlags, "-race")
+	}
+	tmpDir, binPath, buildOutput, err := buildProgram(generateProgram(code), buildFlags)
+	if err != nil {
+		fmt.Print(outputColor(buildOutput))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fmt.Println(infoColor("Running the snippet %d times, %d at a time...", runs, parallel))
+	start := time.Now()
+
+	// 1. Run the binary from a pool of workers
+	results := make([]stressRun, runs)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				cmd := exec.CommandContext(ctx, binPath, args...)
+				cmd.WaitDelay = time.Second
+				output, err := cmd.CombinedOutput()
+				res := stressRun{index: i, output: string(output), status: "ok"}
+				if ctx.Err() == context.DeadlineExceeded {
+					res.status = "timeout"
+				} else if err != nil {
+					res.status = err.Error()
+				}
+				cancel()
+				results[i] = res
+			}
+		}()
+	}
+	for i := 0; i < runs; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// 2. Group the runs by output and status
+	ordered := groupStressRuns(results)
+	firstFailure := -1
+	for _, res := range results {
+		if res.status != "ok" {
+			firstFailure = res.index
+			break
+		}
+	}
+
+	var lines []string
+	for i, g := range ordered {
+		status := successColor("%s", g.status)
+		if g.status != "ok" {
+			status = errorColor("%s", g.status)
+		}
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, infoColor("#%d: %d of %d runs (%.1f%%), status ", i+1, g.count, runs, 100*float64(g.count)/float64(runs))+status)
+		outputLines := strings.Split(strings.TrimSuffix(g.output, "\n"), "\n")
+		if len(outputLines) > maxStressGroupLines {
+			hidden := len(outputLines) - maxStressGroupLines
+			outputLines = append(outputLines[:maxStressGroupLines], fmt.Sprintf("... (%d more lines)", hidden))
+		}
+		for _, line := range outputLines {
+			lines = append(lines, "  "+outputColor(line))
+		}
+	}
+	printBoxed("Stress Results", lines)
+
+	if firstFailure >= 0 {
+		fmt.Println(errorColor("First failing run (#%d, %s):", firstFailure+1, results[firstFailure].status))
+		printOutput(results[firstFailure].output)
+	}
+
+	if len(ordered) == 1 && firstFailure < 0 {
+		fmt.Println(successColor("All %d runs produced the same output in %s.", runs, elapsed.Round(time.Millisecond)))
+	} else {
+		fmt.Fprintln(os.Stderr, errorColor("%d distinct outcomes over %d runs in %s.", len(ordered), runs, elapsed.Round(time.Millisecond)))
+	}
+}
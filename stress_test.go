@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestGroupStressRuns(t *testing.T) {
+	race := func(addr, g string) string {
+		return "WARNING: DATA RACE\nWrite at " + addr + " by goroutine " + g + ":\n"
+	}
+	results := []stressRun{
+		{index: 0, output: "1\n", status: "ok"},
+		{index: 1, output: race("0x00c000012345", "7"), status: "exit status 66"},
+		{index: 2, output: "2\n", status: "ok"},
+		{index: 3, output: race("0x00c0000abcde", "9"), status: "exit status 66"},
+		{index: 4, output: "1\n", status: "ok"},
+		{index: 5, output: "1\n", status: "timeout"},
+		{index: 6, output: race("0x00c000012345", "7"), status: "exit status 66"},
+	}
+	got := groupStressRuns(results)
+	want := []stressGroup{
+		{output: race("0x00c000012345", "7"), status: "exit status 66", count: 3},
+		{output: "1\n", status: "ok", count: 2},
+		{output: "2\n", status: "ok", count: 1},
+		{output: "1\n", status: "timeout", count: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("groupStressRuns() = %d groups, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("group %d = %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// traceHarness is compiled along with the generated program to record an execution
+// trace; goblinTraceStop is deferred by main to flush it.
+const traceHarness = `package main
+
+import (
+	"os"
+	"runtime/trace"
+)
+
+var goblinTraceFile *os.File
+
+func init() {
+	f, err := os.Create(os.Getenv("GOBLIN_TRACE_FILE"))
+	if err != nil {
+		panic(err)
+	}
+	goblinTraceFile = f
+	if err := trace.Start(f); err != nil {
+		panic(err)
+	}
+}
+
+func goblinTraceStop() {
+	trace.Stop()
+	goblinTraceFile.Close()
+}
+`
+
+// traceEvent is an event of the text dump printed by 'go tool trace -d=parsed'.
+type traceEvent struct {
+	kind       string
+	time       int64
+	goID       int64 // Goroutine concerned by a state transition
+	from, to   string
+	reason     string
+	name       string // Name of a range
+	scope      string // Scope of a range
+	stack      []profileFrame
+	transStack []profileFrame // Stack of the goroutine changing state
+}
+
+var (
+	traceEventRegex      = regexp.MustCompile(`^M=\S+ P=\S+ G=\S+ (\w+) Time=(\d+)(.*)$`)
+	traceTransitionRegex = regexp.MustCompile(`GoID=(\d+) (\w+)->(\w+) Reason="([^"]*)"`)
+	traceNameRegex       = regexp.MustCompile(`Name="([^"]*)"`)
+	traceScopeRegex      = regexp.MustCompile(`Scope=(\S+)`)
+	traceFrameRegex      = regexp.MustCompile(`^\t(.+) @ 0x[0-9a-f]+$`)
+	traceFileRegex       = regexp.MustCompile(`^\t\t(.+):(\d+)$`)
+)
+
+// readTraceEvents decodes a trace file using the text dump of 'go tool trace'.
+// The dump is a debugging format, so only the fields needed for the summary are read.
+func readTraceEvents(path string) ([]traceEvent, error) {
+	cmd := exec.Command("go", "tool", "trace", "-d=parsed", path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	events, err := parseTraceEvents(stdout)
+	if err != nil {
+		cmd.Wait()
+		return nil, err
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("go tool trace: %w", err)
+	}
+	return events, nil
+}
+
+// parseTraceEvents reads the events of the text dump of a trace, with their stacks.
+func parseTraceEvents(r io.Reader) ([]traceEvent, error) {
+	var events []traceEvent
+	var stack *[]profileFrame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if matches := traceEventRegex.FindStringSubmatch(line); matches != nil {
+			ev := traceEvent{kind: matches[1]}
+			ev.time, _ = strconv.ParseInt(matches[2], 10, 64)
+			rest := matches[3]
+			if m := traceTransitionRegex.FindStringSubmatch(rest); m != nil {
+				ev.goID, _ = strconv.ParseInt(m[1], 10, 64)
+				ev.from, ev.to, ev.reason = m[2], m[3], m[4]
+			}
+			if m := traceNameRegex.FindStringSubmatch(rest); m != nil {
+				ev.name = m[1]
+			}
+			if m := traceScopeRegex.FindStringSubmatch(rest); m != nil {
+				ev.scope = m[1]
+			}
+			events = append(events, ev)
+			stack = nil
+			continue
+		}
+		if len(events) == 0 {
+			continue
+		}
+		ev := &events[len(events)-1]
+		switch {
+		case line == "Stack=":
+			stack = &ev.stack
+		case line == "TransitionStack=":
+			stack = &ev.transStack
+		case stack == nil:
+		default:
+			if m := traceFrameRegex.FindStringSubmatch(line); m != nil {
+				*stack = append(*stack, profileFrame{Function: m[1]})
+			} else if m := traceFileRegex.FindStringSubmatch(line); m != nil && len(*stack) > 0 {
+				frame := &(*stack)[len(*stack)-1]
+				frame.File = m[1]
+				frame.Line, _ = strconv.Atoi(m[2])
+			}
+		}
+	}
+	return events, scanner.Err()
+}
+
+// blockCategory groups the reasons for which a goroutine waits.
+func blockCategory(reason string) string {
+	switch {
+	case strings.HasPrefix(reason, "chan") || strings.HasPrefix(reason, "select"):
+		return "chan"
+	case strings.HasPrefix(reason, "sync"):
+		return "sync"
+	case reason == "sleep":
+		return "sleep"
+	case reason == "network":
+		return "net"
+	}
+	return "other"
+}
+
+// goroutineSummary accumulates what happened to a goroutine during the trace.
+type goroutineSummary struct {
+	id          int64
+	createdLine int    // Buffer line of the go statement, 0 for main
+	function    string // Function the goroutine runs
+	blocked     map[string]time.Duration
+	blockStart  int64
+	blockReason string
+	created     int64
+	ended       int64
+}
+
+// printTraceSummary prints the goroutines started by the buffer, their blocking times
+// and the garbage collections found in the trace events.
+func printTraceSummary(events []traceEvent, codeLines []string, lineMap []int) {
+	goroutines := make(map[int64]*goroutineSummary)
+	var start, end int64
+	var gcCycles int
+	var gcPause, gcMaxPause time.Duration
+	rangeStarts := make(map[string]int64)
+
+	for _, ev := range events {
+		if start == 0 || ev.time < start {
+			start = ev.time
+		}
+		if ev.time > end {
+			end = ev.time
+		}
+
+		switch ev.kind {
+		case "RangeBegin":
+			rangeStarts[ev.name+"|"+ev.scope] = ev.time
+			if ev.name == "GC concurrent mark phase" {
+				gcCycles++
+			}
+		case "RangeEnd":
+			begin, ok := rangeStarts[ev.name+"|"+ev.scope]
+			if ok && strings.HasPrefix(ev.name, "stop-the-world (GC") {
+				pause := time.Duration(ev.time - begin)
+				gcPause += pause
+				if pause > gcMaxPause {
+					gcMaxPause = pause
+				}
+			}
+		case "StateTransition":
+			g := goroutines[ev.goID]
+			if ev.from == "NotExist" {
+				// Only the goroutines started from the buffer are reported
+				for _, f := range ev.stack {
+					if !isBufferFrame(f) {
+						continue
+					}
+					if n := bufferLine(lineMap, f.Line); n > 0 {
+						g = &goroutineSummary{id: ev.goID, createdLine: n, created: ev.time, blocked: map[string]time.Duration{}}
+						if len(ev.transStack) > 0 {
+							g.function = ev.transStack[0].Function
+						}
+						goroutines[ev.goID] = g
+					}
+					break
+				}
+				continue
+			}
+			if g == nil && ev.goID == 1 {
+				g = &goroutineSummary{id: 1, function: "main.main", created: ev.time, blocked: map[string]time.Duration{}}
+				goroutines[1] = g
+			}
+			if g == nil {
+				continue
+			}
+			// Close the current blocking period, if any
+			if g.blockReason != "" && ev.from != ev.to {
+				g.blocked[g.blockReason] += time.Duration(ev.time - g.blockStart)
+				g.blockReason = ""
+			}
+			switch ev.to {
+			case "Waiting":
+				g.blockReason, g.blockStart = blockCategory(ev.reason), ev.time
+			case "Syscall":
+				g.blockReason, g.blockStart = "syscall", ev.time
+			case "NotExist":
+				g.ended = ev.time
+			}
+		}
+	}
+
+	ids := make([]int64, 0, len(goroutines))
+	for id := range goroutines {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	round := func(d time.Duration) string {
+		if d == 0 {
+			return "-"
+		}
+		return d.Round(time.Microsecond).String()
+	}
+	rows := []string{fmt.Sprintf("%5s  %-10s %-10s %-10s %-10s %-10s %-10s  %s", "G", "chan", "sync", "syscall", "sleep", "other", "lifetime", "created at")}
+	created, leaked := 0, 0
+	for _, id := range ids {
+		g := goroutines[id]
+		// Goroutines still waiting when the trace stops are charged until its end
+		if g.blockReason != "" {
+			g.blocked[g.blockReason] += time.Duration(end - g.blockStart)
+		}
+		// Only the goroutines started by a line of the buffer are counted, not main or
+		// the ones of the runtime and of the tracer
+		if g.createdLine > 0 {
+			created++
+		}
+		lifetime := "alive"
+		if g.ended > 0 {
+			lifetime = round(time.Duration(g.ended - g.created))
+		} else if g.createdLine > 0 {
+			leaked++
+		}
+		site := "main"
+		if g.createdLine > 0 {
+			site = fmt.Sprintf("line %d: %s (%s)", g.createdLine, strings.TrimSpace(codeLines[g.createdLine-1]), g.function)
+		}
+		rows = append(rows, fmt.Sprintf("%5d  %-10s %-10s %-10s %-10s %-10s %-10s  %s", id,
+			round(g.blocked["chan"]), round(g.blocked["sync"]), round(g.blocked["syscall"]),
+			round(g.blocked["sleep"]), round(g.blocked["other"]+g.blocked["net"]), lifetime, site))
+	}
+	printBoxed("Goroutines (time blocked)", rows)
+
+	fmt.Println(infoColor("Goroutines created by the buffer: %d, still alive when main returned: %d.", created, leaked))
+	fmt.Println(infoColor("GC cycles: %d, total stop-the-world pause: %s, longest: %s.", gcCycles, round(gcPause), round(gcMaxPause)))
+	fmt.Println(infoColor("Trace duration: %s.", round(time.Duration(end-start))))
+}
+
+// handleTrace runs the buffer with the execution tracer enabled and prints a summary
+// of the goroutines and garbage collections. The raw trace is kept in PROFILES_DIR.
+func handleTrace(codeLines []string, args []string) {
+	if err := os.MkdirAll(PROFILES_DIR, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error creating profiles directory: %v", err))
+		return
+	}
+	name := currentSnippetName
+	if name == "" {
+		name = "snippet"
+	}
+	tracePath := filepath.Join(PROFILES_DIR, fmt.Sprintf("%s_trace_%s.out", name, time.Now().Format("20060102_150405")))
+
+	program, lineMap := generateProgramMap(strings.Join(codeLines, "\n"))
+	program = deferInMain(program, "goblinTraceStop")
+	tmpDir, binPath, buildOutput, err := buildProgramFiles(program, map[string]string{"goblin_trace.go": traceHarness}, nil, nil)
+	if err != nil {
+		fmt.Print(outputColor(buildOutput))
+		fmt.Fprintln(os.Stderr, errorColor("Build failed: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.Command(binPath, args...)
+	cmd.Env = append(os.Environ(), "GOBLIN_TRACE_FILE="+tracePath)
+	output, execErr := cmd.CombinedOutput()
+	printOutput(string(output))
+	if execErr != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Code Execution Finished with Error Status."))
+	}
+
+	events, err := readTraceEvents(tracePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorColor("Error reading trace: %v", err))
+		fmt.Println(infoColor("The trace is only complete when main returns normally."))
+		return
+	}
+	printTraceSummary(events, codeLines, lineMap)
+	fmt.Println(infoColor("Raw trace saved to '%s'. Use 'go tool trace %s' to explore it.", tracePath, tracePath))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceEvents(t *testing.T) {
+	dump := `M=1 P=0 G=1 RangeBegin Time=100 Name="stop-the-world (GC)" Scope=Goroutine(1)
+Stack=
+	runtime.GC @ 0x4010
+		/go/src/runtime/mgc.go:500
+
+M=1 P=0 G=1 StateTransition Time=200 GoID=6 NotExist->Runnable Reason=""
+TransitionStack=
+	main.main.func1 @ 0x4020
+		/tmp/repl_code.go:21
+
+Stack=
+	main.main @ 0x4030
+		/tmp/repl_code.go:20
+
+M=1 P=0 G=6 StateTransition Time=300 GoID=6 Running->Waiting Reason="chan receive"
+M=-1 P=-1 G=-1 Metric Time=400 Name="/gc/heap/goal:bytes" Value=Value{Uint64(4194304)}
+not an event
+`
+	got, err := parseTraceEvents(strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("parseTraceEvents() error = %v", err)
+	}
+	want := []traceEvent{
+		{kind: "RangeBegin", time: 100, name: "stop-the-world (GC)", scope: "Goroutine(1)",
+			stack: []profileFrame{{Function: "runtime.GC", File: "/go/src/runtime/mgc.go", Line: 500}}},
+		{kind: "StateTransition", time: 200, goID: 6, from: "NotExist", to: "Runnable",
+			stack:      []profileFrame{{Function: "main.main", File: "/tmp/repl_code.go", Line: 20}},
+			transStack: []profileFrame{{Function: "main.main.func1", File: "/tmp/repl_code.go", Line: 21}}},
+		{kind: "StateTransition", time: 300, goID: 6, from: "Running", to: "Waiting", reason: "chan receive"},
+		{kind: "Metric", time: 400, name: "/gc/heap/goal:bytes"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTraceEvents() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestBlockCategory(t *testing.T) {
+	tests := map[string]string{
+		"chan receive":  "chan",
+		"select":        "chan",
+		"sync.Mutex":    "sync",
+		"sleep":         "sleep",
+		"network":       "net",
+		"GC background": "other",
+	}
+	for reason, want := range tests {
+		if got := blockCategory(reason); got != want {
+			t.Errorf("blockCategory(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
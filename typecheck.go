@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// typeCheckMu serializes the type checks, which share importedPackages.
+	typeCheckMu sync.Mutex
+	// importedPackages type-checks the imported packages from their source, without running
+	// the go command, and keeps them for the next checks.
+	importedPackages *sourceImporter
+)
+
+// sourceImporter imports packages by type-checking their source. Unlike the source importer
+// of go/importer, it finds the packages with its own build context, where cgo is disabled so
+// that packages such as net are checked from their pure Go files, without changing
+// build.Default for the rest of the process.
+type sourceImporter struct {
+	ctxt     build.Context
+	fset     *token.FileSet
+	packages map[string]*types.Package // Packages imported, nil while being imported
+}
+
+// newSourceImporter returns an importer of packages from their source, with cgo disabled.
+func newSourceImporter() *sourceImporter {
+	ctxt := build.Default
+	ctxt.CgoEnabled = false
+	return &sourceImporter{ctxt: ctxt, fset: token.NewFileSet(), packages: make(map[string]*types.Package)}
+}
+
+func (p *sourceImporter) Import(path string) (*types.Package, error) {
+	return p.ImportFrom(path, "", 0)
+}
+
+func (p *sourceImporter) ImportFrom(path, dir string, _ types.ImportMode) (*types.Package, error) {
+	bp, err := p.ctxt.Import(path, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if bp.ImportPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := p.packages[bp.ImportPath]; ok {
+		if pkg == nil {
+			return nil, fmt.Errorf("import cycle through package %q", bp.ImportPath)
+		}
+		return pkg, nil
+	}
+	p.packages[bp.ImportPath] = nil
+	defer func() {
+		if p.packages[bp.ImportPath] == nil {
+			delete(p.packages, bp.ImportPath)
+		}
+	}()
+
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		file, err := parser.ParseFile(p.fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	var hardErr error
+	conf := types.Config{
+		IgnoreFuncBodies: true,
+		Importer:         p,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok && !typeErr.Soft && hardErr == nil {
+				hardErr = err
+			}
+		},
+	}
+	pkg, err := conf.Check(bp.ImportPath, p.fset, files, nil)
+	if hardErr != nil {
+		return nil, fmt.Errorf("type-checking package %q failed (%v)", bp.ImportPath, hardErr)
+	} else if err != nil {
+		return pkg, fmt.Errorf("type-checking package %q failed (%v)", bp.ImportPath, err)
+	}
+	p.packages[bp.ImportPath] = pkg
+	return pkg, nil
+}
+
+// typeCheckProgram parses and type-checks a generated program. It returns the parse
+// error if the program does not parse, and otherwise every type error found, along
+// with the information recorded on the program, which is complete when there are none.
+func typeCheckProgram(program string) (*token.FileSet, *ast.File, *types.Info, []types.Error, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "repl_code.go", program, 0)
+	if err != nil {
+		return fset, nil, nil, nil, err
+	}
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:     make(map[ast.Node]*types.Scope),
+		Implicits:  make(map[ast.Node]types.Object),
+	}
+	var typeErrors []types.Error
+
+	typeCheckMu.Lock()
+	defer typeCheckMu.Unlock()
+	if importedPackages == nil {
+		importedPackages = newSourceImporter()
+	}
+	conf := &types.Config{
+		Importer: importedPackages,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				typeErrors = append(typeErrors, typeErr)
+			}
+		},
+	}
+	conf.Check("main", fset, []*ast.File{file}, info)
+	return fset, file, info, typeErrors, nil
+}
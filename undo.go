@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// maxBufferChanges is how many changes of the buffer can be undone.
+const maxBufferChanges = 1000
+
+// bufferChange is a change of the buffer, the unit of :undo and :redo: an entry of code,
+// whatever its number of lines, a paste, or a command changing the buffer. Only the lines
+// changed are kept: the lines between the ones the buffer before and after the change
+// start and end with.
+type bufferChange struct {
+	what    string // The entry or the command
+	at      int    // Index of the first line changed
+	removed []string
+	added   []string
+	size    int // Lines of the buffer after the change
+
+	before, after bufferMarks // Entries and snippet of the buffer before and after the change
+}
+
+// bufferMarks is what a change of the buffer changes besides its lines: where its entries
+// start, and the snippet it is saved as.
+type bufferMarks struct {
+	entries []int
+	name    string // Snippet name
+	path    string // File loaded or saved
+}
+
+// bufferState is the buffer with its marks, before or after a change.
+type bufferState struct {
+	lines []string
+	bufferMarks
+}
+
+// currentBufferState returns the state of the buffer codeLines of the session.
+func currentBufferState(codeLines []string) bufferState {
+	return bufferState{slices.Clone(codeLines), bufferMarks{slices.Clone(bufferEntries), currentSnippetName, lastLoadedFilePath}}
+}
+
+// restore gives the buffer the marks m when undoing or redoing a change from the marks
+// other. The snippet is left as it is unless the change loaded or cleared it.
+func (m bufferMarks) restore(other bufferMarks) {
+	bufferEntries = slices.Clone(m.entries)
+	if m.name != other.name || m.path != other.path {
+		currentSnippetName, lastLoadedFilePath = m.name, m.path
+	}
+}
+
+// newBufferChange returns the change from the buffer before to the buffer after.
+func newBufferChange(what string, before, after []string) bufferChange {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	return bufferChange{
+		what:    what,
+		at:      prefix,
+		removed: slices.Clone(before[prefix : len(before)-suffix]),
+		added:   slices.Clone(after[prefix : len(after)-suffix]),
+		size:    len(after),
+	}
+}
+
+// apply makes the change on the buffer before it, and revert undoes it on the buffer after
+// it. They fail when the buffer does not have the size and the lines expected.
+func (c bufferChange) apply(codeLines []string) ([]string, bool) {
+	return c.splice(codeLines, c.size-len(c.added)+len(c.removed), c.removed, c.added)
+}
+
+func (c bufferChange) revert(codeLines []string) ([]string, bool) {
+	return c.splice(codeLines, c.size, c.added, c.removed)
+}
+
+// splice replaces the lines old of a buffer of size lines, at the line changed, by new.
+func (c bufferChange) splice(codeLines []string, size int, old, new []string) ([]string, bool) {
+	if len(codeLines) != size || !slices.Equal(codeLines[c.at:c.at+len(old)], old) {
+		return codeLines, false
+	}
+	return slices.Concat(codeLines[:c.at], new, codeLines[c.at+len(old):]), true
+}
+
+// summary describes the lines changed.
+func (c bufferChange) summary() string {
+	first, removed, added := c.at+1, len(c.removed), len(c.added)
+	switch {
+	case removed == 0:
+		return fmt.Sprintf("%s added", lineRange(first, c.at+added))
+	case added == 0:
+		return fmt.Sprintf("%s removed", lineRange(first, c.at+removed))
+	case added == removed:
+		return fmt.Sprintf("%s changed", lineRange(first, c.at+added))
+	}
+	return fmt.Sprintf("%s replaced by %d", lineRange(first, c.at+removed), added)
+}
+
+// lineRange names buffer lines from first to last.
+func lineRange(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("line %d", first)
+	}
+	return fmt.Sprintf("lines %d-%d", first, last)
+}
+
+// bufferHistory is the history of the changes of the buffer.
+type bufferHistory struct {
+	changes []bufferChange
+	undone  int // Changes at the end of changes which were undone, and can be redone
+}
+
+// bufferChanges is the history of the buffer of the session.
+var bufferChanges bufferHistory
+
+// record adds a change to the history, unless the lines of the buffer are unchanged. The
+// changes which were undone cannot be redone anymore.
+func (h *bufferHistory) record(what string, before, after bufferState) {
+	if slices.Equal(before.lines, after.lines) {
+		return
+	}
+	change := newBufferChange(what, before.lines, after.lines)
+	change.before, change.after = before.bufferMarks, after.bufferMarks
+	h.changes = append(h.changes[:len(h.changes)-h.undone], change)
+	h.undone = 0
+	if len(h.changes) > maxBufferChanges {
+		h.changes = slices.Delete(h.changes, 0, len(h.changes)-maxBufferChanges)
+	}
+}
+
+// undo undoes the last change not undone yet on the buffer, if any. It returns the buffer
+// and the change, and false when there is nothing to undo or the buffer does not match.
+func (h *bufferHistory) undo(codeLines []string) ([]string, bufferChange, bool) {
+	if h.undone == len(h.changes) {
+		return codeLines, bufferChange{}, false
+	}
+	change := h.changes[len(h.changes)-h.undone-1]
+	codeLines, ok := change.revert(codeLines)
+	if ok {
+		h.undone++
+	}
+	return codeLines, change, ok
+}
+
+// redo redoes the last change undone on the buffer, if any. It returns the buffer and the
+// change, and false when there is nothing to redo or the buffer does not match.
+func (h *bufferHistory) redo(codeLines []string) ([]string, bufferChange, bool) {
+	if h.undone == 0 {
+		return codeLines, bufferChange{}, false
+	}
+	change := h.changes[len(h.changes)-h.undone]
+	codeLines, ok := change.apply(codeLines)
+	if ok {
+		h.undone--
+	}
+	return codeLines, change, ok
+}
+
+// describeInput returns how the change made by an input is listed in the history: the
+// command, or the first line of the entry of code the input is part of.
+func describeInput(input string, entry []string) string {
+	isCommand := strings.HasPrefix(strings.TrimSpace(input), ":")
+	if len(entry) > 0 && (!isCommand || scanEntry(entry).inLiteral()) {
+		input = entry[0]
+	}
+	what := strings.TrimSpace(input)
+	if len(what) > 40 {
+		what = what[:37] + "..."
+	}
+	return what
+}
+
+// handleUndo undoes the last change of the buffer and returns the buffer.
+func handleUndo(codeLines []string) []string {
+	if bufferChanges.undone == len(bufferChanges.changes) {
+		fmt.Println(infoColor("No change of the buffer to undo."))
+		return codeLines
+	}
+	codeLines, change, ok := bufferChanges.undo(codeLines)
+	if !ok {
+		fmt.Fprintln(os.Stderr, errorColor("Cannot undo %s: the buffer does not have the lines it changed anymore.", change.what))
+		return codeLines
+	}
+	change.before.restore(change.after)
+	bufferDirty = true
+	fmt.Println(successColor("Undone: %s (%s).", change.what, change.summary()))
+	return codeLines
+}
+
+// handleRedo redoes the last change of the buffer undone and returns the buffer.
+func handleRedo(codeLines []string) []string {
+	if bufferChanges.undone == 0 {
+		fmt.Println(infoColor("No undone change of the buffer to redo."))
+		return codeLines
+	}
+	codeLines, change, ok := bufferChanges.redo(codeLines)
+	if !ok {
+		fmt.Fprintln(os.Stderr, errorColor("Cannot redo %s: the buffer does not have the lines it changed anymore.", change.what))
+		return codeLines
+	}
+	change.after.restore(change.before)
+	bufferDirty = true
+	fmt.Println(successColor("Redone: %s (%s).", change.what, change.summary()))
+	return codeLines
+}
+
+// handleHistory lists the changes of the buffer, from the oldest one.
+func handleHistory(args []string) {
+	if len(args) != 1 || args[0] != "buffer" {
+		fmt.Println(infoColor("Usage: :history buffer"))
+		return
+	}
+	h := bufferChanges
+	if len(h.changes) == 0 {
+		fmt.Println(infoColor("No change of the buffer yet."))
+		return
+	}
+	for i, change := range h.changes {
+		line := fmt.Sprintf("%4d: %-40s %s", i+1, change.what, change.summary())
+		if i >= len(h.changes)-h.undone {
+			fmt.Println(infoColor("%s (undone)", line))
+		} else {
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBufferChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after []string
+		summary       string
+	}{
+		{"append", []string{"a"}, []string{"a", "b", "c"}, "lines 2-3 added"},
+		{"insert", []string{"a", "c"}, []string{"a", "b", "c"}, "line 2 added"},
+		{"remove", []string{"a", "b", "c"}, []string{"a", "c"}, "line 2 removed"},
+		{"change", []string{"a", "b", "c"}, []string{"a", "x", "c"}, "line 2 changed"},
+		{"replace", []string{"a", "b", "c"}, []string{"x", "y", "z", "w"}, "lines 1-3 replaced by 4"},
+		{"repeated lines", []string{"}", "}"}, []string{"}", "}", "}"}, "line 3 added"},
+		{"empty before", nil, []string{"a"}, "line 1 added"},
+		{"emptied", []string{"a", "b"}, nil, "lines 1-2 removed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := newBufferChange("test", tt.before, tt.after)
+			if got := change.summary(); got != tt.summary {
+				t.Errorf("summary() = %q, want %q", got, tt.summary)
+			}
+			undone, ok := change.revert(tt.after)
+			if !ok || !slices.Equal(undone, tt.before) {
+				t.Errorf("undo = %q, %v, want %q", undone, ok, tt.before)
+			}
+			redone, ok := change.apply(tt.before)
+			if !ok || !slices.Equal(redone, tt.after) {
+				t.Errorf("redo = %q, %v, want %q", redone, ok, tt.after)
+			}
+		})
+	}
+}
+
+func TestBufferHistory(t *testing.T) {
+	var h bufferHistory
+	buffers := [][]string{
+		nil,
+		{"x := 1"},
+		{"x := 1", "y := 2"},
+		{"x := 1", "y := 3"},
+		{"y := 3"},
+	}
+	for i := 1; i < len(buffers); i++ {
+		h.record("change", bufferState{lines: buffers[i-1]}, bufferState{lines: buffers[i]})
+	}
+	h.record("unchanged", bufferState{lines: buffers[len(buffers)-1]}, bufferState{lines: buffers[len(buffers)-1]})
+	if len(h.changes) != len(buffers)-1 {
+		t.Fatalf("%d changes recorded, want %d", len(h.changes), len(buffers)-1)
+	}
+
+	codeLines := buffers[len(buffers)-1]
+	for i := len(buffers) - 2; i >= 0; i-- {
+		var ok bool
+		if codeLines, _, ok = h.undo(codeLines); !ok || !slices.Equal(codeLines, buffers[i]) {
+			t.Fatalf("undo = %q, %v, want %q", codeLines, ok, buffers[i])
+		}
+	}
+	if _, _, ok := h.undo(codeLines); ok {
+		t.Errorf("undo with no change left succeeded")
+	}
+	for i := 1; i < len(buffers); i++ {
+		var ok bool
+		if codeLines, _, ok = h.redo(codeLines); !ok || !slices.Equal(codeLines, buffers[i]) {
+			t.Fatalf("redo = %q, %v, want %q", codeLines, ok, buffers[i])
+		}
+	}
+	if _, _, ok := h.redo(codeLines); ok {
+		t.Errorf("redo with no change undone succeeded")
+	}
+
+	// A buffer not having the size the history expects is left as it is
+	if got, _, ok := h.undo([]string{"z := 4", "w := 5"}); ok || len(got) != 2 {
+		t.Errorf("undo of a mismatching buffer = %q, %v", got, ok)
+	}
+}
+
+func TestBufferHistoryMarks(t *testing.T) {
+	defer func(entries []int, name, path string) {
+		bufferEntries, currentSnippetName, lastLoadedFilePath = entries, name, path
+	}(bufferEntries, currentSnippetName, lastLoadedFilePath)
+	bufferChanges = bufferHistory{}
+	defer func() { bufferChanges = bufferHistory{} }()
+
+	a := bufferState{[]string{"x := 1", "y := 2"}, bufferMarks{[]int{0, 1}, "a", "/a.go"}}
+	b := bufferState{[]string{"func f() {", "}"}, bufferMarks{[]int{0}, "b", "/b.go"}}
+	edited := bufferState{[]string{"func f() {", "}", "f()"}, bufferMarks{[]int{0, 2}, "b", "/b.go"}}
+	bufferChanges.record(":load b", a, b)
+	bufferChanges.record("f()", b, edited)
+
+	// Undoing a change which did not load a snippet leaves the snippet renamed since
+	currentSnippetName = "renamed"
+	codeLines := handleUndo(edited.lines)
+	if !slices.Equal(bufferEntries, b.entries) || currentSnippetName != "renamed" {
+		t.Errorf("after undo of f(): entries %v, snippet %q, want %v, %q", bufferEntries, currentSnippetName, b.entries, "renamed")
+	}
+	codeLines = handleUndo(codeLines)
+	if !slices.Equal(codeLines, a.lines) || !slices.Equal(bufferEntries, a.entries) ||
+		currentSnippetName != a.name || lastLoadedFilePath != a.path {
+		t.Errorf("after undo of :load: %q, entries %v, snippet %q in %q, want %q, %v, %q in %q",
+			codeLines, bufferEntries, currentSnippetName, lastLoadedFilePath, a.lines, a.entries, a.name, a.path)
+	}
+	codeLines = handleRedo(codeLines)
+	if !slices.Equal(codeLines, b.lines) || currentSnippetName != b.name || lastLoadedFilePath != b.path {
+		t.Errorf("after redo of :load: %q, snippet %q in %q, want %q, %q in %q",
+			codeLines, currentSnippetName, lastLoadedFilePath, b.lines, b.name, b.path)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// watchedVars holds the names of the variables set with :watch. Their assignments in
+// the statements of main are printed during :run.
+var watchedVars []string
+
+// watchHarness is compiled along with a generated program instrumented by instrumentAssignments.
+const watchHarness = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func goblinWatch(line int, name string, value interface{}) {
+	if s, ok := value.(string); ok {
+		fmt.Fprintf(os.Stderr, "line %d: %s = %q\n", line, name, s)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "line %d: %s = %v\n", line, name, value)
+}
+`
+
+// insertion is a text to insert at an offset of a program.
+type insertion struct {
+	offset int
+	text   string
+}
+
+// applyInsertions inserts texts in a program. Insertions at the same offset are kept in order.
+func applyInsertions(program string, insertions []insertion) string {
+	sort.SliceStable(insertions, func(i, j int) bool { return insertions[i].offset < insertions[j].offset })
+	var b strings.Builder
+	last := 0
+	for _, ins := range insertions {
+		b.WriteString(program[last:ins.offset])
+		b.WriteString(ins.text)
+		last = ins.offset
+	}
+	b.WriteString(program[last:])
+	return b.String()
+}
+
+// findMainFunc returns the declaration of main in a parsed program.
+func findMainFunc(file *ast.File) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" && fn.Body != nil {
+			return fn
+		}
+	}
+	return nil
+}
+
+// assignedIdents returns the variables assigned by a statement of a statement list.
+func assignedIdents(stmt ast.Stmt) []*ast.Ident {
+	var idents []*ast.Ident
+	addIdent := func(expr ast.Expr) {
+		if ident, ok := expr.(*ast.Ident); ok && ident.Name != "_" {
+			idents = append(idents, ident)
+		}
+	}
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range s.Lhs {
+			addIdent(lhs)
+		}
+	case *ast.IncDecStmt:
+		addIdent(s.X)
+	case *ast.DeclStmt:
+		if gen, ok := s.Decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+			for _, spec := range gen.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					addIdent(name)
+				}
+			}
+		}
+	}
+	return idents
+}
+
+// unusedVars returns the variables declared in a function body which are never used other
+// than by being assigned with =, which the compiler reports.
+func unusedVars(body *ast.BlockStmt) map[*ast.Object]bool {
+	assigned := make(map[*ast.Ident]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.AssignStmt:
+			if node.Tok == token.ASSIGN || node.Tok == token.DEFINE {
+				for _, lhs := range node.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok {
+						assigned[ident] = true
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			for _, name := range node.Names {
+				assigned[name] = true
+			}
+		case *ast.RangeStmt:
+			for _, expr := range []ast.Expr{node.Key, node.Value} {
+				if ident, ok := expr.(*ast.Ident); ok {
+					assigned[ident] = true
+				}
+			}
+		}
+		return true
+	})
+	unused := make(map[*ast.Object]bool)
+	used := make(map[*ast.Object]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || ident.Obj == nil || ident.Obj.Kind != ast.Var {
+			return true
+		}
+		if !assigned[ident] {
+			used[ident.Obj] = true
+		} else if pos := ident.Obj.Pos(); pos > body.Pos() && pos < body.End() {
+			unused[ident.Obj] = true
+		}
+		return true
+	})
+	for obj := range used {
+		delete(unused, obj)
+	}
+	return unused
+}
+
+// instrumentAssignments adds a call to goblinWatch after each assignment to the watched
+// variables in main, or to any variable when all is true. The calls are added on the
+// line of the assignment, so the line numbers of the program are unchanged.
+//
+// The variables of main which are never used are not instrumented, so that the compiler
+// still reports them. The variables of the init statements of if, for and switch, such as
+// i in for i := 0; i < n; i++, are not instrumented either, as no call can follow them there.
+func instrumentAssignments(program string, lineMap []int, watched []string, all bool) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "repl_code.go", program, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	mainFunc := findMainFunc(file)
+	if mainFunc == nil {
+		return "", fmt.Errorf("no main function found")
+	}
+
+	isWatched := make(map[string]bool)
+	for _, name := range watched {
+		isWatched[name] = true
+	}
+
+	unused := unusedVars(mainFunc.Body)
+	var insertions []insertion
+	watchCall := func(pos token.Pos, idents []*ast.Ident) string {
+		line := bufferLine(lineMap, fset.Position(pos).Line)
+		var calls []string
+		for _, ident := range idents {
+			if unused[ident.Obj] {
+				continue
+			}
+			if all || isWatched[ident.Name] {
+				calls = append(calls, fmt.Sprintf("goblinWatch(%d, %q, %s)", line, ident.Name, ident.Name))
+			}
+		}
+		return strings.Join(calls, "; ")
+	}
+
+	instrumentList := func(list []ast.Stmt) {
+		for _, stmt := range list {
+			if call := watchCall(stmt.Pos(), assignedIdents(stmt)); call != "" {
+				insertions = append(insertions, insertion{fset.Position(stmt.End()).Offset, "; " + call})
+			}
+		}
+	}
+
+	ast.Inspect(mainFunc.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.BlockStmt:
+			instrumentList(node.List)
+		case *ast.CaseClause:
+			instrumentList(node.Body)
+		case *ast.CommClause:
+			instrumentList(node.Body)
+		case *ast.RangeStmt:
+			// The variables of a range clause are reported at the start of the body
+			var idents []*ast.Ident
+			for _, expr := range []ast.Expr{node.Key, node.Value} {
+				if ident, ok := expr.(*ast.Ident); ok && ident.Name != "_" {
+					idents = append(idents, ident)
+				}
+			}
+			if call := watchCall(node.Pos(), idents); call != "" {
+				insertions = append(insertions, insertion{fset.Position(node.Body.Lbrace).Offset + 1, " " + call + ";"})
+			}
+		}
+		return true
+	})
+
+	return applyInsertions(program, insertions), nil
+}
+
+// handleWatch adds variables to the watch list, or lists the watched variables.
+func handleWatch(args []string) {
+	if len(args) == 0 {
+		if len(watchedVars) == 0 {
+			fmt.Println(infoColor("No variables are watched. Usage: :watch <var> [<var>...]"))
+		} else {
+			fmt.Println(infoColor("Watched variables: %s", strings.Join(watchedVars, ", ")))
+		}
+		return
+	}
+	for _, name := range args {
+		if !token.IsIdentifier(name) {
+			fmt.Fprintln(os.Stderr, errorColor("Invalid variable name: %s.", name))
+			return
+		}
+	}
+	for _, name := range args {
+		found := false
+		for _, w := range watchedVars {
+			found = found || w == name
+		}
+		if !found {
+			watchedVars = append(watchedVars, name)
+		}
+	}
+	fmt.Println(successColor("Watched variables: %s. Their assignments are shown by :run.", strings.Join(watchedVars, ", ")))
+}
+
+// handleUnwatch removes variables from the watch list, or clears it.
+func handleUnwatch(args []string) {
+	if len(args) == 0 {
+		watchedVars = nil
+		fmt.Println(successColor("No variables are watched anymore."))
+		return
+	}
+	var kept []string
+	for _, w := range watchedVars {
+		remove := false
+		for _, name := range args {
+			remove = remove || w == name
+		}
+		if !remove {
+			kept = append(kept, w)
+		}
+	}
+	watchedVars = kept
+	if len(watchedVars) == 0 {
+		fmt.Println(successColor("No variables are watched anymore."))
+	} else {
+		fmt.Println(successColor("Watched variables: %s", strings.Join(watchedVars, ", ")))
+	}
+}
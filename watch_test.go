@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstrumentAssignments(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		watched []string
+		all     bool
+		want    []string // Calls expected in the program
+		notWant []string // Calls not expected
+	}{
+		{
+			name:    "watched variable",
+			code:    "x := 1\ny := 2\nx = y + 1\nprintln(x)",
+			watched: []string{"x"},
+			want:    []string{`goblinWatch(1, "x", x)`, `goblinWatch(3, "x", x)`},
+			notWant: []string{`"y"`},
+		},
+		{
+			name: "all variables",
+			code: "x := 1\ny, z := 2, 3\ny++\nprintln(x, y, z)",
+			all:  true,
+			want: []string{`goblinWatch(1, "x", x)`, `goblinWatch(2, "y", y); goblinWatch(2, "z", z)`, `goblinWatch(3, "y", y)`},
+		},
+		{
+			name: "global variable",
+			code: "var g int\ng = 1",
+			all:  true,
+			want: []string{`goblinWatch(2, "g", g)`},
+		},
+		{
+			name:    "unused variable left to the compiler",
+			code:    "x := 1\nx = 2",
+			all:     true,
+			notWant: []string{"goblinWatch"},
+		},
+		{
+			name: "range variables",
+			code: "for i, v := range []int{1} {\n\tprintln(i, v)\n}",
+			all:  true,
+			want: []string{`goblinWatch(1, "i", i); goblinWatch(1, "v", v);`},
+		},
+		{
+			name:    "init statement",
+			code:    "for i := 0; i < 2; i++ {\n\tprintln(i)\n}",
+			all:     true,
+			notWant: []string{"goblinWatch"},
+		},
+		{
+			name:    "blank identifier",
+			code:    "_ = 1",
+			all:     true,
+			notWant: []string{"goblinWatch"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, lineMap := generateProgramMap(tt.code)
+			got, err := instrumentAssignments(program, lineMap, tt.watched, tt.all)
+			if err != nil {
+				t.Fatalf("instrumentAssignments() error = %v", err)
+			}
+			if strings.Count(got, "\n") != strings.Count(program, "\n") {
+				t.Errorf("instrumentAssignments() changed the number of lines:\n%s", got)
+			}
+			for _, call := range tt.want {
+				if !strings.Contains(got, call) {
+					t.Errorf("instrumentAssignments() has no %s:\n%s", call, got)
+				}
+			}
+			for _, call := range tt.notWant {
+				if strings.Contains(got, call) {
+					t.Errorf("instrumentAssignments() has %s:\n%s", call, got)
+				}
+			}
+		})
+	}
+}